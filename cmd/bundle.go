@@ -3,11 +3,13 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/hinkolas/mdoc/internal/bundle"
+	"github.com/hinkolas/mdoc/internal/config"
 	"github.com/hinkolas/mdoc/internal/document"
 	"github.com/hinkolas/mdoc/internal/theme"
 )
@@ -26,7 +28,11 @@ var bundleCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		outPath, err := bundle.ResolveOutputPath(doc, bundleOutput)
+		user, err := config.Load()
+		if err != nil {
+			return err
+		}
+		outPath, err := bundle.ResolveOutputPath(doc, firstNonEmpty(bundleOutput, user.OutputPath(doc.Path, ".mdoc")))
 		if err != nil {
 			return err
 		}
@@ -39,7 +45,11 @@ var bundleCmd = &cobra.Command{
 			return nil
 		}
 
-		thm, twarn := theme.Resolve(doc.Config.Theme, doc.Dir)
+		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+			return fmt.Errorf("create output dir: %w", err)
+		}
+
+		thm, twarn := theme.Resolve(doc.Config.Theme, doc.Dir, doc.Project)
 
 		start := time.Now()
 		res, err := bundle.Export(doc, thm, bundle.Options{OutputPath: outPath})
@@ -65,7 +75,7 @@ var bundleCmd = &cobra.Command{
 }
 
 func init() {
-	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "Output bundle path (default: <input>.mdoc)")
+	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "Output bundle path (default: <input>.mdoc, or under output.dir from the user config)")
 	bundleCmd.Flags().BoolVarP(&bundleForce, "force", "f", false, "Overwrite the output file if it already exists")
 	rootCmd.AddCommand(bundleCmd)
 }
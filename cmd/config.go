@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hinkolas/mdoc/internal/config"
+	"github.com/hinkolas/mdoc/internal/document"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read and write user settings in ~/.config/mdoc/config.yaml.",
+	Long: `Read and write user settings in ~/.config/mdoc/config.yaml.
+
+Keys are dotted paths. The defaults section holds frontmatter defaults merged
+under every document (the document's own frontmatter wins); preview.port and
+output.dir set defaults for command-line flags (an explicit flag wins), and
+preview.editor is the command a Ctrl-click in the preview opens the source with.
+
+  mdoc config set defaults.author "Jane Doe"
+  mdoc config set defaults.labels.figure Abbildung
+  mdoc config set preview.port 0
+  mdoc config set preview.editor "code -g {file}:{line}"
+  mdoc config set output.dir out
+  mdoc config get defaults.labels
+  mdoc config list`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the value of a setting.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := config.Open()
+		if err != nil {
+			return err
+		}
+		v, ok := f.Get(args[0])
+		if !ok {
+			return fmt.Errorf("%s is not set", args[0])
+		}
+		fmt.Println(config.Format(v))
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a setting. The value is read as YAML, so true, 7768 and [a, b] keep their types.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := config.Open()
+		if err != nil {
+			return err
+		}
+		if err := f.Set(args[0], config.ParseValue(args[1])); err != nil {
+			return err
+		}
+		// Validate before writing so a misspelled key or a wrongly-typed value
+		// is rejected here, not on the next render.
+		c, err := f.Config()
+		if err != nil {
+			return err
+		}
+		if err := c.CheckDefaults(&document.Config{}); err != nil {
+			return fmt.Errorf("invalid defaults: %w", err)
+		}
+		return f.Save()
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List every setting as key=value.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := config.Open()
+		if err != nil {
+			return err
+		}
+		for _, e := range f.List() {
+			fmt.Printf("%s=%s\n", e.Key, e.Value)
+		}
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd, configSetCmd, configListCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -10,22 +10,35 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/hinkolas/mdoc/internal/browser"
+	"github.com/hinkolas/mdoc/internal/config"
 	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/paths"
 	"github.com/hinkolas/mdoc/internal/preview"
 	"github.com/hinkolas/mdoc/internal/theme"
 )
 
 var (
-	openPort    int
-	openVerbose bool
+	openPort     int
+	openHost     string
+	openVerbose  bool
+	openNoWindow bool
+	openBrowser  string
 )
 
 var openCmd = &cobra.Command{
 	Use:   "open <file>",
 	Short: "Open a live preview of a markdown document in a chromeless chromium window.",
-	Args:  cobra.ExactArgs(1),
+	Long: `Open a live preview of a markdown document in a chromeless chromium window.
+
+--browser default opens the preview in your regular browser instead, and
+--no-window opens nothing: the server just runs, and you open the URL it prints
+wherever you like. Neither needs chromium, but the preview's Print button does.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		docPath := args[0]
+		if openBrowser != "chromium" && openBrowser != "default" {
+			return fmt.Errorf("--browser must be chromium or default, not %q", openBrowser)
+		}
 
 		// Parse once up front so we fail fast on bad frontmatter rather than
 		// after opening a browser window. A missing/broken theme is NOT fatal —
@@ -34,10 +47,21 @@ var openCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		thm, twarn := theme.Resolve(doc.Config.Theme, doc.Dir)
+		thm, twarn := theme.Resolve(doc.Config.Theme, doc.Dir, doc.Project)
+
+		// An explicit --port wins; otherwise preview.port from the user config,
+		// then the flag default.
+		port := openPort
+		user, err := config.Load()
+		if err != nil {
+			return err
+		}
+		if !cmd.Flags().Changed("port") && user.Preview.Port != nil {
+			port = *user.Preview.Port
+		}
 
 		srv := preview.New(doc.Path, Version)
-		if err := srv.Start(openPort); err != nil {
+		if err := srv.Start(openHost, port); err != nil {
 			return err
 		}
 		defer srv.Shutdown()
@@ -56,14 +80,13 @@ var openCmd = &cobra.Command{
 		if twarn != nil {
 			lastWarning = twarn.Error()
 		}
-		watchPaths := append([]string{doc.Path}, theme.SearchDirs()...)
 		var watcher *preview.Watcher
 		watcher, err = preview.NewWatcher(func(changed string) {
 			themePath, warning, docErr := srv.CurrentTheme()
 			watcher.WatchTheme(themePath)
-			// Re-derive the include set on every change so adding or removing a
-			// `:::include` starts or stops watching the referenced chapter live.
-			watcher.WatchIncludes(srv.CurrentIncludes())
+			// Re-derive the dependency set on every change so adding or removing
+			// a `:::include` starts or stops watching the referenced chapter live.
+			watcher.WatchDependencies(srv.CurrentDependencies())
 			if err := srv.PushReload(); err != nil {
 				fmt.Fprintln(os.Stderr, "reload:", err)
 			}
@@ -86,16 +109,16 @@ var openCmd = &cobra.Command{
 				}
 				lastWarning = warning
 			}
-		}, watchPaths...)
+		}, watchPaths(doc)...)
 		if err != nil {
 			return err
 		}
 		defer watcher.Close()
 		watcher.WatchTheme(thm.Path)
-		watcher.WatchIncludes(doc.Includes)
+		watcher.WatchDependencies(doc.Dependencies())
 		go watcher.Run()
 
-		printStartupBanner(Version, srv.URL(), doc.Path)
+		printStartupBanner(Version, srv.URL(), srv.NetworkURLs(), doc.Path)
 		// With --verbose, surface an initial theme problem as the first
 		// live-log line so it reads as part of the same stream; otherwise stay
 		// quiet and let the preview UI report it.
@@ -103,24 +126,33 @@ var openCmd = &cobra.Command{
 			logLiveWarn(twarn.Error())
 		}
 
-		br, err := browser.AppMode(srv.URL())
-		if err != nil {
-			return err
-		}
-		defer br.Close()
-
 		// Block until either the user closes the window or sends a signal.
 		sig := make(chan os.Signal, 1)
 		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 
 		// When the user closes the --app window, Chromium destroys the
-		// target. That's our cue to exit cleanly.
+		// target. That's our cue to exit cleanly. A preview in the default
+		// browser, or none at all, runs until the signal: a tab closing
+		// isn't something we can see.
 		windowClosed := make(chan struct{})
-		go func() {
-			defer close(windowClosed)
-			wait := br.RodBrowser().WaitEvent(&proto.TargetTargetDestroyed{})
-			wait()
-		}()
+		switch {
+		case openNoWindow:
+		case openBrowser == "default":
+			if err := preview.OpenInDefaultBrowser(srv.URL()); err != nil {
+				return fmt.Errorf("open browser: %w", err)
+			}
+		default:
+			br, err := browser.AppMode(srv.URL())
+			if err != nil {
+				return err
+			}
+			defer br.Close()
+			go func() {
+				defer close(windowClosed)
+				wait := br.RodBrowser().WaitEvent(&proto.TargetTargetDestroyed{})
+				wait()
+			}()
+		}
 
 		select {
 		case <-sig:
@@ -132,20 +164,42 @@ var openCmd = &cobra.Command{
 }
 
 func init() {
-	openCmd.Flags().IntVarP(&openPort, "port", "p", 7768, "Preview server port (0 = pick a free port)")
+	openCmd.Flags().IntVarP(&openPort, "port", "p", 7768, "Preview server port (0 = pick a free port; default from preview.port in the user config)")
+	openCmd.Flags().StringVar(&openHost, "host", "127.0.0.1", "Interface to serve the preview on (0.0.0.0 = reachable from the network, behind a random access token)")
 	openCmd.Flags().BoolVar(&openVerbose, "verbose", false, "Stream reload and theme-diagnostic logs to the terminal")
+	openCmd.Flags().BoolVar(&openNoWindow, "no-window", false, "Start the preview server and print its URL without opening a window")
+	openCmd.Flags().StringVar(&openBrowser, "browser", "chromium", "Browser to open the preview in: chromium (a chromeless app window) or default (your regular browser)")
+	openCmd.MarkFlagsMutuallyExclusive("no-window", "browser")
 	rootCmd.AddCommand(openCmd)
 }
 
+// watchPaths returns the files and directories a live session watches from
+// the start: the document, the theme search directories — so a theme being
+// created or switched is noticed — and the user config file, whose `defaults`
+// feed every document, so editing it re-renders like a frontmatter edit. The
+// active theme file and the document's dependencies change over the session
+// and are followed through Watcher.WatchTheme and WatchDependencies.
+func watchPaths(doc *document.Document) []string {
+	watch := append([]string{doc.Path}, theme.SearchDirs(doc.Project)...)
+	if cfgFile, err := paths.ConfigFile(); err == nil {
+		watch = append(watch, cfgFile)
+	}
+	return watch
+}
+
 // printStartupBanner writes the small Vite-style block that introduces the
-// preview session — version, URL, document. The theme is deliberately not
-// shown: it can be changed live during the session, so a fixed banner value
-// would go stale (and theme problems are reported as warnings instead).
-func printStartupBanner(_, url, docPath string) {
+// preview session — version, URL, network URLs when served beyond loopback,
+// document. The theme is deliberately not shown: it can be changed live during
+// the session, so a fixed banner value would go stale (and theme problems are
+// reported as warnings instead).
+func printStartupBanner(_, url string, network []string, docPath string) {
 	display := displayPath(docPath)
 
 	printBrandHeader()
 	printRow(10, "preview", underline(url))
+	for _, u := range network {
+		printRow(10, "network", underline(u))
+	}
 	printRow(10, "document", display)
 	fmt.Println()
 	fmt.Printf("  %s\n\n", dim("press ctrl+c to stop"))
@@ -3,11 +3,17 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttmpl "text/template"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/hinkolas/mdoc/internal/config"
 	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/funcs"
 	"github.com/hinkolas/mdoc/internal/print"
 	"github.com/hinkolas/mdoc/internal/theme"
 )
@@ -16,18 +22,33 @@ var (
 	printOutput  string
 	printHTMLOut bool
 	printForce   bool
+	printEach    string
 )
 
 var printCmd = &cobra.Command{
 	Use:   "print <file>",
 	Short: "Render a markdown document to PDF.",
-	Args:  cobra.ExactArgs(1),
+	Long: `Render a markdown document to PDF.
+
+With --each, the document is rendered once per record of a CSV, JSON or YAML
+file (a mail merge). The current record is {{.Row}} in the body and theme, and
+--output is a template for each file's name:
+
+  mdoc print letter.md --each recipients.csv --output "out/{{.Row.name}}.pdf"`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		doc, err := document.Open(args[0])
 		if err != nil {
 			return err
 		}
-		outPath, err := print.ResolveOutputPath(doc, printOutput)
+		user, err := config.Load()
+		if err != nil {
+			return err
+		}
+		if printEach != "" {
+			return printEachRecord(doc, user)
+		}
+		outPath, err := print.ResolveOutputPath(doc, firstNonEmpty(printOutput, user.OutputPath(doc.Path, ".pdf")))
 		if err != nil {
 			return err
 		}
@@ -40,7 +61,11 @@ var printCmd = &cobra.Command{
 			return nil
 		}
 
-		thm, twarn := theme.Resolve(doc.Config.Theme, doc.Dir)
+		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+			return fmt.Errorf("create output dir: %w", err)
+		}
+
+		thm, twarn := theme.Resolve(doc.Config.Theme, doc.Dir, doc.Project)
 		start := time.Now()
 		out, err := print.Print(doc, thm, print.Options{
 			OutputPath: outPath,
@@ -58,7 +83,7 @@ var printCmd = &cobra.Command{
 		// fallback is folded into the banner in a TTY; in a pipe it goes to
 		// stderr (full detail) so it neither pollutes stdout nor is lost.
 		if !stdoutIsTTY {
-			fmt.Println(out)
+			fmt.Println(out.Path)
 			if twarn != nil {
 				printWarn(twarn.Error())
 			}
@@ -70,27 +95,23 @@ var printCmd = &cobra.Command{
 }
 
 func init() {
-	printCmd.Flags().StringVarP(&printOutput, "output", "o", "", "Output PDF path (default: <input>.pdf)")
+	printCmd.Flags().StringVarP(&printOutput, "output", "o", "", "Output PDF path (default: <input>.pdf, or under output.dir from the user config)")
 	printCmd.Flags().BoolVar(&printHTMLOut, "html", false, "Also write the rendered HTML alongside the PDF")
 	printCmd.Flags().BoolVarP(&printForce, "force", "f", false, "Overwrite the output file if it already exists")
+	printCmd.Flags().StringVar(&printEach, "each", "", "Render once per record of a CSV/JSON/YAML file, exposed as {{.Row}}; --output becomes a name template")
 	rootCmd.AddCommand(printCmd)
 }
 
-func printPrintBanner(srcPath, outPath string, dur time.Duration, themeWarn error) {
+func printPrintBanner(srcPath string, res *print.Result, dur time.Duration, themeWarn error) {
 	src := displayPath(srcPath)
-	dst := displayPath(outPath)
-
-	size := ""
-	if fi, err := os.Stat(outPath); err == nil {
-		size = humanSize(fi.Size())
-	}
+	dst := displayPath(res.Path)
 
-	meta := ""
-	if size != "" {
-		meta = fmt.Sprintf("  %s", dim(fmt.Sprintf("(%s · %s)", size, shortDuration(dur))))
-	} else {
-		meta = fmt.Sprintf("  %s", dim(fmt.Sprintf("(%s)", shortDuration(dur))))
+	facts := []string{fmt.Sprintf("%d %s", res.Pages, plural(res.Pages, "page", "pages"))}
+	if fi, err := os.Stat(res.Path); err == nil {
+		facts = append(facts, humanSize(fi.Size()))
 	}
+	facts = append(facts, shortDuration(dur))
+	meta := "  " + dim("("+strings.Join(facts, " · ")+")")
 
 	printBrandHeader()
 	printRow(8, "source", src)
@@ -104,3 +125,152 @@ func printPrintBanner(srcPath, outPath string, dur time.Duration, themeWarn erro
 	fmt.Println()
 }
 
+// printEachRecord is `mdoc print --each`: one PDF per record, all printed with
+// one Chromium. Every output name is worked out (and checked for clashes and
+// existing files) before the first render, so a bad --output template fails
+// fast instead of after a hundred PDFs.
+func printEachRecord(doc *document.Document, user *config.Config) error {
+	records, err := document.ReadRecords(printEach)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("%s has no records", displayPath(printEach))
+	}
+	outPaths, err := eachOutputPaths(doc, firstNonEmpty(printOutput, user.OutputPath(doc.Path, ".pdf")), records)
+	if err != nil {
+		return err
+	}
+	proceed, err := confirmOverwriteAll(outPaths, printForce)
+	if err != nil {
+		return err
+	}
+	if !proceed {
+		fmt.Fprintf(os.Stderr, "%s cancelled — no files written\n", red("✗"))
+		return nil
+	}
+
+	thm, twarn := theme.Resolve(doc.Config.Theme, doc.Dir, doc.Project)
+	printer, err := print.NewPrinter(doc.Dir)
+	if err != nil {
+		return err
+	}
+	defer printer.Close()
+
+	start := time.Now()
+	for i, row := range records {
+		if err := os.MkdirAll(filepath.Dir(outPaths[i]), 0o755); err != nil {
+			return fmt.Errorf("create output dir: %w", err)
+		}
+		out, err := printer.Print(doc, thm, print.Options{
+			OutputPath: outPaths[i],
+			WriteHTML:  printHTMLOut,
+			Version:    Version,
+			Row:        row,
+		})
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i+1, err)
+		}
+		if !stdoutIsTTY {
+			fmt.Println(out.Path)
+		}
+	}
+	dur := time.Since(start)
+
+	if !stdoutIsTTY {
+		if twarn != nil {
+			printWarn(twarn.Error())
+		}
+		return nil
+	}
+	printBrandHeader()
+	printRow(8, "source", displayPath(doc.Path))
+	printRow(8, "records", fmt.Sprintf("%d from %s", len(records), displayPath(printEach)))
+	printRow(8, "output", displayPath(outPaths[0])+"  "+dim(fmt.Sprintf("(first of %d · %s)", len(outPaths), shortDuration(dur))))
+	if fb, ok := twarn.(*theme.Fallback); ok {
+		printRowMarked(yellow("⚠"), 8, "theme", fb.Short())
+	} else if twarn != nil {
+		printRowMarked(yellow("⚠"), 8, "theme", twarn.Error())
+	}
+	fmt.Println()
+	return nil
+}
+
+// eachOutputPaths expands the --output name template once per record, with
+// {{.Row}} the record and {{.Index}} its 1-based position. An empty pattern
+// numbers the default output: letter-01.pdf, letter-02.pdf, …. Path separators
+// in record values become "-", so a value names a file rather than a path, and
+// every name must stay inside the directory the template's fixed prefix names
+// ("out/" in "out/{{.Row.name}}.pdf"). A field missing from a record, a name
+// outside that directory, or two records mapping to the same file is an error.
+func eachOutputPaths(doc *document.Document, pattern string, records []map[string]any) ([]string, error) {
+	if pattern == "" {
+		def, err := print.ResolveOutputPath(doc, "")
+		if err != nil {
+			return nil, err
+		}
+		width := len(strconv.Itoa(len(records)))
+		ext := filepath.Ext(def)
+		pattern = strings.TrimSuffix(def, ext) + fmt.Sprintf("-{{printf \"%%0%dd\" .Index}}", width) + ext
+	}
+	tmpl, err := texttmpl.New("output").Funcs(funcs.Map(funcs.Env{})).Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("parse --output template: %w", err)
+	}
+	prefix, _, _ := strings.Cut(pattern, "{{")
+	root, err := filepath.Abs(filepath.Dir(prefix + "x"))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(records))
+	seen := make(map[string]int, len(records))
+	for i, row := range records {
+		var b strings.Builder
+		data := struct {
+			Row   map[string]any
+			Index int
+		}{fileNameSafe(row).(map[string]any), i + 1}
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("record %d: --output: %w", i+1, err)
+		}
+		path, err := print.ResolveOutputPath(doc, b.String())
+		if err != nil {
+			return nil, err
+		}
+		if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("record %d: --output names %s, outside %s", i+1, displayPath(path), displayPath(root))
+		}
+		if prev, dup := seen[path]; dup {
+			return nil, fmt.Errorf("records %d and %d both write %s; make --output differ per record, e.g. with {{.Row.name}} or {{.Index}}", prev, i+1, displayPath(path))
+		}
+		seen[path] = i + 1
+		out[i] = path
+	}
+	return out, nil
+}
+
+// pathSeparators turns the path separators in a record value into "-".
+var pathSeparators = strings.NewReplacer("/", "-", `\`, "-")
+
+// fileNameSafe returns v with pathSeparators applied to every string in it, at
+// any depth, for use in an --output name.
+func fileNameSafe(v any) any {
+	switch v := v.(type) {
+	case string:
+		return pathSeparators.Replace(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = fileNameSafe(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = fileNameSafe(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hinkolas/mdoc/internal/document"
+)
+
+func TestEachOutputPaths(t *testing.T) {
+	dir := t.TempDir()
+	doc := &document.Document{Path: filepath.Join(dir, "letter.md"), Dir: dir}
+	records := make([]map[string]any, 10)
+	for i := range records {
+		records[i] = map[string]any{"name": string(rune('a' + i))}
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		want0   string
+		want9   string
+		wantErr string
+	}{
+		{"default numbers the output", "", filepath.Join(dir, "letter-01.pdf"), filepath.Join(dir, "letter-10.pdf"), ""},
+		{"row fields and functions", filepath.Join(dir, "out", "{{.Row.name | upper}}.pdf"), filepath.Join(dir, "out", "A.pdf"), filepath.Join(dir, "out", "J.pdf"), ""},
+		{"missing field", "{{.Row.nmae}}.pdf", "", "", "record 1"},
+		{"same file twice", filepath.Join(dir, "same.pdf"), "", "", "records 1 and 2 both write"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := eachOutputPaths(doc, tt.pattern, records)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got[0] != tt.want0 || got[9] != tt.want9 {
+				t.Errorf("paths = %s … %s, want %s … %s", got[0], got[9], tt.want0, tt.want9)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/mdext"
+	"github.com/hinkolas/mdoc/internal/print"
+	"github.com/hinkolas/mdoc/internal/render"
+	"github.com/hinkolas/mdoc/internal/theme"
+)
+
+var statsNoPages bool
+
+// statsReport is the JSON `mdoc stats` writes.
+type statsReport struct {
+	mdext.Stats
+	// Pages is the PDF page count; left out with --no-pages.
+	Pages *int `json:"pages,omitempty"`
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats <file>",
+	Short: "Print a document's word, character and page counts as JSON.",
+	Long: `Print a document's word, character and page counts as JSON.
+
+Words and characters are counted as configured by stats.exclude in the
+frontmatter (code and math are left out by default). The page count lays the
+document out as ` + "`mdoc print`" + ` would, which needs chromium; --no-pages skips it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		doc, err := document.Open(args[0])
+		if err != nil {
+			return err
+		}
+		thm, twarn := theme.Resolve(doc.Config.Theme, doc.Dir, doc.Project)
+		var report statsReport
+		if statsNoPages {
+			_, td, err := render.RenderThemed(doc, thm, render.Options{Version: Version})
+			if err != nil {
+				return err
+			}
+			report.Stats = td.Stats
+		} else {
+			// The page count's render carries the stats too.
+			p, err := print.NewPrinter(doc.Dir)
+			if err != nil {
+				return err
+			}
+			defer p.Close()
+			n, td, err := p.Pages(doc, thm, print.Options{Version: Version})
+			if err != nil {
+				return err
+			}
+			report.Stats, report.Pages = td.Stats, &n
+		}
+
+		// stdout carries only the JSON, so a theme fallback goes to stderr.
+		if twarn != nil {
+			printWarn(twarn.Error())
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	},
+}
+
+func init() {
+	statsCmd.Flags().BoolVar(&statsNoPages, "no-pages", false, "Skip the page count (no chromium needed)")
+	rootCmd.AddCommand(statsCmd)
+}
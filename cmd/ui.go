@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -43,8 +44,33 @@ func confirmOverwrite(outPath string, force bool) (bool, error) {
 	if !stdinIsTTY {
 		return false, fmt.Errorf("%s already exists; pass --force to overwrite", displayPath(outPath))
 	}
-	fmt.Fprintf(os.Stderr, "%s %s already exists. Overwrite? %s ",
-		yellow("?"), bold(displayPath(outPath)), dim("[y/N]"))
+	return askOverwrite(fmt.Sprintf("%s already exists. Overwrite?", bold(displayPath(outPath))))
+}
+
+// confirmOverwriteAll is confirmOverwrite for a batch of outputs: one question
+// covering every file that already exists, rather than one per file.
+func confirmOverwriteAll(outPaths []string, force bool) (bool, error) {
+	var existing []string
+	for _, p := range outPaths {
+		if _, err := os.Stat(p); err == nil {
+			existing = append(existing, p)
+		}
+	}
+	if force || len(existing) == 0 {
+		return true, nil
+	}
+	if len(existing) == 1 {
+		return confirmOverwrite(existing[0], force)
+	}
+	if !stdinIsTTY {
+		return false, fmt.Errorf("%d output files already exist (%s, …); pass --force to overwrite", len(existing), displayPath(existing[0]))
+	}
+	return askOverwrite(fmt.Sprintf("%s output files already exist (%s, …). Overwrite them?", bold(strconv.Itoa(len(existing))), displayPath(existing[0])))
+}
+
+// askOverwrite puts a [y/N] question on stderr and reads the answer.
+func askOverwrite(question string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s %s %s ", yellow("?"), question, dim("[y/N]"))
 	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
 	if err != nil && err != io.EOF {
 		return false, err
@@ -130,6 +156,17 @@ func printRowMarked(marker string, labelWidth int, label, value string) {
 	fmt.Printf("  %s  %s%s%s\n", marker, dim(label), pad, value)
 }
 
+// firstNonEmpty returns the first non-empty string, e.g. an explicit flag value
+// ahead of a user-config default.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // displayPath formats a path for the banners: absolute, with the home
 // directory collapsed to "~". Consistent everywhere — see paths.Display.
 func displayPath(p string) string { return paths.Display(p) }
@@ -149,10 +186,11 @@ func logEvent(label string, color func(string) string, detail string) {
 	fmt.Fprintf(os.Stderr, "%s  %s  %s\n", dim(logTime()), color(fmt.Sprintf("%-8s", label)), detail)
 }
 
-func logReload(detail string) { logEvent("reloaded", cyan, dim(detail)) }
-func logReady(detail string)  { logEvent("ready", green, dim(detail)) }
-func logLiveWarn(msg string)  { logEvent("warning", yellow, msg) }
-func logLiveErr(msg string)   { logEvent("error", red, msg) }
+func logReload(detail string)  { logEvent("reloaded", cyan, dim(detail)) }
+func logReady(detail string)   { logEvent("ready", green, dim(detail)) }
+func logPrinted(detail string) { logEvent("printed", green, detail) }
+func logLiveWarn(msg string)   { logEvent("warning", yellow, msg) }
+func logLiveErr(msg string)    { logEvent("error", red, msg) }
 
 // humanSize formats a byte count as "267 KB", "1.4 MB", etc. — the kind
 // of unit a user actually cares about for a generated artifact.
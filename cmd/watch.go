@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hinkolas/mdoc/internal/config"
+	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/preview"
+	"github.com/hinkolas/mdoc/internal/print"
+	"github.com/hinkolas/mdoc/internal/theme"
+)
+
+var watchOutput string
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <file>",
+	Short: "Re-print a markdown document to PDF on every change, without a window.",
+	Long: `Re-print a markdown document to PDF on every change, without a window.
+
+watch follows the same files as ` + "`mdoc open`" + ` — the document, its theme, its
+includes and other dependencies, the user config — and prints the PDF again
+each time one of them is saved, with one status line per rebuild. Headless
+Chromium stays running between rebuilds, so a PDF viewer that reloads the file
+on change works as the preview, over ssh or in a terminal-only session:
+
+  mdoc watch doc.md -o doc.pdf
+
+The PDF is overwritten without asking.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Parse once up front so bad frontmatter fails fast, like `mdoc open`;
+		// after that a broken document is reported per rebuild instead.
+		doc, err := document.Open(args[0])
+		if err != nil {
+			return err
+		}
+		user, err := config.Load()
+		if err != nil {
+			return err
+		}
+		outPath, err := print.ResolveOutputPath(doc, firstNonEmpty(watchOutput, user.OutputPath(doc.Path, ".pdf")))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+			return fmt.Errorf("create output dir: %w", err)
+		}
+
+		printer, err := print.NewPrinter(doc.Dir)
+		if err != nil {
+			return err
+		}
+		defer printer.Close()
+
+		// The watcher's debounced callbacks can overlap when a print takes
+		// longer than the debounce, and the printer serves one document at a
+		// time, so rebuilds take turns. Theme warnings are deduped against
+		// lastWarning, like the `mdoc open --verbose` log.
+		var (
+			mu          sync.Mutex
+			watcher     *preview.Watcher
+			lastWarning string
+		)
+		rebuild := func(string) {
+			mu.Lock()
+			defer mu.Unlock()
+			cur, err := document.Open(doc.Path)
+			if err != nil {
+				logLiveErr(err.Error())
+				return
+			}
+			thm, twarn := theme.Resolve(cur.Config.Theme, cur.Dir, cur.Project)
+			watcher.WatchTheme(thm.Path)
+			watcher.WatchDependencies(cur.Dependencies())
+			warning := ""
+			if twarn != nil {
+				warning = twarn.Error()
+			}
+			if warning != lastWarning {
+				switch {
+				case warning != "":
+					logLiveWarn(warning)
+				case lastWarning != "":
+					logReady("theme resolved")
+				}
+				lastWarning = warning
+			}
+
+			start := time.Now()
+			out, err := printer.Print(cur, thm, print.Options{OutputPath: outPath, Version: Version})
+			if err != nil {
+				logLiveErr(err.Error())
+				return
+			}
+			logPrinted(fmt.Sprintf("%s  %s", displayPath(out.Path), dim(fmt.Sprintf("(%d %s · %s)",
+				out.Pages, plural(out.Pages, "page", "pages"), shortDuration(time.Since(start))))))
+		}
+		watcher, err = preview.NewWatcher(rebuild, watchPaths(doc)...)
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+
+		printBrandHeader()
+		printRow(8, "source", displayPath(doc.Path))
+		printRow(8, "output", displayPath(outPath))
+		fmt.Println()
+		fmt.Printf("  %s\n\n", dim("press ctrl+c to stop"))
+
+		rebuild(doc.Path)
+		go watcher.Run()
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		fmt.Println()
+		return nil
+	},
+}
+
+func init() {
+	watchCmd.Flags().StringVarP(&watchOutput, "output", "o", "", "Output PDF path (default: <input>.pdf, or under output.dir from the user config)")
+	rootCmd.AddCommand(watchCmd)
+}
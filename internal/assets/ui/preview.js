@@ -3,13 +3,22 @@
 // so what you see is what you print). On file-change events the iframe
 // fetches just the themed body from /preview/body and re-paginates in
 // place, which preserves scroll position and avoids the iframe-reload
-// flicker. The WebSocket only carries a "reload" event — no payload.
+// flicker. Once the iframe holds such a render, later changes come from
+// /preview/patch instead: just the blocks that changed, re-paginated from the
+// first page they can affect. When the change no longer renders, that fetch
+// answers with the error, shown in an overlay over the last good render until
+// the next successful one. The WebSocket carries a "reload" event with no
+// payload and a "goto" event with a source file and line to scroll the pages
+// to. The collapsible
+// sidebar shows the heading tree from /outline, page thumbnails and a page
+// counter; the toolbar sets the zoom, spread layout and layout guides.
 
 (function () {
     const statusEl = document.getElementById("status");
     const frame = document.getElementById("frame");
     const reloadBtn = document.getElementById("btn-reload");
     const printBtn = document.getElementById("btn-print");
+    const overlayEl = document.getElementById("error-overlay");
 
     let statusTimer = null;
     function setStatus(text, state, ttl) {
@@ -39,6 +48,55 @@
         }
     }
 
+    function el(tag, className, text) {
+        const node = document.createElement(tag);
+        if (className) node.className = className;
+        if (text !== undefined) node.textContent = text;
+        return node;
+    }
+
+    // Show a render error over the last good render: the message, the
+    // source position it was pinned to and a code frame around that line.
+    // The pages underneath stay as they were so the user keeps their place.
+    function showError(msg) {
+        overlayEl.replaceChildren();
+        overlayEl.appendChild(el("div", "overlay-title", "Render failed"));
+        if (msg.file) {
+            const loc = el("div", "overlay-loc", msg.line ? `${msg.file}:${msg.line}` : msg.file);
+            overlayEl.appendChild(loc);
+        }
+        overlayEl.appendChild(el("pre", "overlay-message", msg.message || "unknown error"));
+        if (msg.frame && msg.frame.length) {
+            const frameEl = el("pre", "overlay-frame");
+            const width = String(msg.frame[msg.frame.length - 1].line).length;
+            for (const l of msg.frame) {
+                const row = el("div", l.line === msg.line ? "hit" : "");
+                const marker = l.line === msg.line ? ">" : " ";
+                row.appendChild(el("span", "gutter", `${marker} ${String(l.line).padStart(width)} | `));
+                row.appendChild(document.createTextNode(l.text));
+                frameEl.appendChild(row);
+            }
+            overlayEl.appendChild(frameEl);
+        }
+        overlayEl.hidden = false;
+        setStatus("Render failed", "err");
+    }
+
+    function hideError() {
+        overlayEl.hidden = true;
+        overlayEl.replaceChildren();
+    }
+
+    // Show the error a failed /preview/body fetch answered with. Falls back
+    // to the bare status when the body isn't the structured error.
+    async function showFetchError(res) {
+        try {
+            showError(await res.json());
+        } catch (_) {
+            showError({ message: `HTTP ${res.status}` });
+        }
+    }
+
     // Are the iframe document and its __mdocPaginate function ready? We
     // need both before we can do an in-place re-paginate; until they're
     // there we fall back to a full iframe reload.
@@ -53,15 +111,44 @@
     async function repaint() {
         if (!iframeReady()) {
             // Iframe still loading; the initial /preview render is fresh
-            // enough so we can just wait for the next file change.
+            // enough so we can just wait for the next file change. If the
+            // initial render itself failed there's no paginator to repaint
+            // with, so load the page again now that it renders.
+            if (!overlayEl.hidden) {
+                hideError();
+                fullReload();
+            }
             return;
         }
         setStatus("Reloading…", "busy");
         try {
-            const res = await fetch("/preview/body", { cache: "no-store" });
-            if (!res.ok) throw new Error(`HTTP ${res.status}`);
-            const html = await res.text();
-            await frame.contentWindow.__mdocPaginate(html);
+            const win = frame.contentWindow;
+            // Patch the pages from the first changed block onward when the
+            // iframe has a render to patch; fall back to the whole body.
+            const base = win.__mdocVersion();
+            let patched = false;
+            if (base) {
+                const res = await fetch("/preview/patch?base=" + base, { cache: "no-store" });
+                if (!res.ok) {
+                    await showFetchError(res);
+                    return;
+                }
+                const patch = await res.json();
+                setLang(res);
+                patched = !patch.full && await win.__mdocPatch(patch, base);
+            }
+            if (!patched) {
+                const res = await fetch("/preview/body", { cache: "no-store" });
+                if (!res.ok) {
+                    await showFetchError(res);
+                    return;
+                }
+                const html = await res.text();
+                setLang(res);
+                await win.__mdocPaginate(html, Number(res.headers.get("X-Mdoc-Version")) || 0);
+            }
+            hideError();
+            refreshSidebar();
             await refreshStatus();
         } catch (err) {
             console.error("repaint failed", err);
@@ -69,6 +156,12 @@
         }
     }
 
+    // Keep <html lang> current: Chromium hyphenates by it.
+    function setLang(res) {
+        const lang = res.headers.get("X-Mdoc-Lang");
+        if (lang) frame.contentDocument.documentElement.lang = lang;
+    }
+
     function fullReload() {
         // Cache-bust just in case; /preview already sets Cache-Control:
         // no-store but iframes can be finicky.
@@ -77,8 +170,237 @@
         frame.src = u.pathname + u.search;
     }
 
-    frame.addEventListener("load", () => {
-        refreshStatus();
+    // Sidebar: the document's heading tree, page thumbnails, and a page
+    // counter that doubles as "go to page N". The pages live in the
+    // iframe; shell.html exposes __mdocPages, __mdocCurrentPage,
+    // __mdocGotoPage and __mdocGotoHeading to reach them.
+    const sidebarEl = document.getElementById("sidebar");
+    const sidebarBtn = document.getElementById("btn-sidebar");
+    const outlineEl = document.getElementById("outline");
+    const thumbsEl = document.getElementById("thumbs");
+    const pagerEl = document.getElementById("pager");
+    const pageInput = document.getElementById("page-input");
+    const pageCountEl = document.getElementById("page-count");
+    const thumbWidth = 150;
+    let thumbsStale = true;
+    let thumbObserver = null;
+
+    function setSidebar(open) {
+        sidebarEl.hidden = !open;
+        try { localStorage.setItem("mdoc.sidebar", open ? "open" : ""); } catch (_) {}
+        if (open) refreshSidebar();
+    }
+
+    sidebarBtn.addEventListener("click", () => setSidebar(sidebarEl.hidden));
+    try { sidebarEl.hidden = localStorage.getItem("mdoc.sidebar") !== "open"; } catch (_) {}
+
+    sidebarEl.querySelectorAll(".tabs button").forEach(tab => {
+        tab.addEventListener("click", () => {
+            sidebarEl.querySelectorAll(".tabs button").forEach(t => t.classList.toggle("active", t === tab));
+            outlineEl.hidden = tab.dataset.panel !== "outline";
+            thumbsEl.hidden = tab.dataset.panel !== "thumbs";
+            if (!thumbsEl.hidden && thumbsStale) buildThumbs();
+        });
+    });
+
+    // Build the heading tree from /outline: each heading nests under the
+    // nearest shallower heading before it. A failed render keeps the last
+    // tree; the overlay reports the error.
+    async function refreshOutline() {
+        let data;
+        try {
+            const res = await fetch("/outline", { cache: "no-store" });
+            if (!res.ok) return;
+            data = await res.json();
+        } catch (_) {
+            return;
+        }
+        const root = { level: 0, list: el("ul") };
+        const stack = [root];
+        for (const h of data.headings) {
+            while (stack[stack.length - 1].level >= h.level) stack.pop();
+            const parent = stack[stack.length - 1];
+            if (!parent.list) parent.item.appendChild(parent.list = el("ul"));
+            const a = el("a");
+            a.href = "#" + h.id;
+            a.title = h.title;
+            if (h.number) a.appendChild(el("span", "num", h.number));
+            a.appendChild(el("span", "", h.title));
+            a.addEventListener("click", (e) => {
+                e.preventDefault();
+                if (iframeReady()) frame.contentWindow.__mdocGotoHeading(h.id);
+            });
+            const item = el("li");
+            item.appendChild(a);
+            parent.list.appendChild(item);
+            stack.push({ level: h.level, item, list: null });
+        }
+        outlineEl.replaceChildren(data.headings.length ? root.list : el("div", "empty", "No headings"));
+    }
+
+    // Thumbnails are clones of the iframe's pages, scaled down. Each sits
+    // in a shadow root that adopts the iframe's stylesheets, so the theme
+    // applies without leaking into the chrome, and the custom properties
+    // of the iframe's root (paged.js keeps the page size there) are copied
+    // onto its host. A page is only cloned once its thumbnail scrolls into
+    // view, which keeps long documents cheap.
+    function buildThumbs() {
+        thumbsStale = false;
+        if (thumbObserver) thumbObserver.disconnect();
+        thumbsEl.replaceChildren();
+        if (!iframeReady()) return;
+        const win = frame.contentWindow;
+        const doc = frame.contentDocument;
+        const sheet = new CSSStyleSheet();
+        sheet.replaceSync(Array.from(doc.querySelectorAll("style"), s => s.textContent).join("\n"));
+        const rootStyle = win.getComputedStyle(doc.documentElement);
+        const vars = [];
+        for (let i = 0; i < rootStyle.length; i++) {
+            if (rootStyle[i].startsWith("--")) vars.push([rootStyle[i], rootStyle.getPropertyValue(rootStyle[i])]);
+        }
+
+        const pageOf = new Map();
+        win.__mdocPages().forEach((page, i) => {
+            const style = win.getComputedStyle(page);
+            const width = parseFloat(style.width);
+            const scale = thumbWidth / width;
+            const thumb = el("button", "thumb");
+            thumb.dataset.page = String(i + 1);
+            thumb.title = `Page ${i + 1}`;
+            thumb.style.width = thumbWidth + "px";
+            thumb.style.height = Math.round(parseFloat(style.height) * scale) + "px";
+            thumb.addEventListener("click", () => gotoPage(i + 1));
+            thumbsEl.appendChild(thumb);
+            pageOf.set(thumb, { page, width, scale });
+        });
+
+        thumbObserver = new IntersectionObserver((entries) => {
+            for (const entry of entries) {
+                if (!entry.isIntersecting) continue;
+                thumbObserver.unobserve(entry.target);
+                const { page, width, scale } = pageOf.get(entry.target);
+                const host = el("div");
+                host.style.cssText = `width: ${width}px; transform: scale(${scale}); transform-origin: 0 0; pointer-events: none;`;
+                vars.forEach(([k, v]) => host.style.setProperty(k, v));
+                const shadow = host.attachShadow({ mode: "open" });
+                shadow.adoptedStyleSheets = [sheet];
+                const pages = el("div", "pagedjs_pages");
+                pages.style.cssText = "padding: 0; display: block;";
+                const clone = page.cloneNode(true);
+                // Relative image URLs resolve against the iframe's <base>,
+                // which the chrome doesn't have; pin them to absolute URLs.
+                const imgs = page.querySelectorAll("img");
+                clone.querySelectorAll("img").forEach((img, j) => { img.src = imgs[j].src; });
+                pages.appendChild(clone);
+                shadow.appendChild(pages);
+                entry.target.appendChild(host);
+            }
+        }, { root: thumbsEl, rootMargin: "400px 0px" });
+        pageOf.forEach((_, thumb) => thumbObserver.observe(thumb));
+        updatePager();
+    }
+
+    function gotoPage(n) {
+        if (iframeReady()) frame.contentWindow.__mdocGotoPage(n);
+    }
+
+    // Reflect the page at the middle of the view in the counter and the
+    // thumbnail strip.
+    function updatePager() {
+        if (!iframeReady()) return;
+        const win = frame.contentWindow;
+        const count = win.__mdocPages().length;
+        const current = win.__mdocCurrentPage();
+        pageCountEl.textContent = String(count);
+        pageInput.max = String(Math.max(count, 1));
+        if (document.activeElement !== pageInput) pageInput.value = String(current);
+        thumbsEl.querySelectorAll(".thumb").forEach(t => {
+            t.classList.toggle("current", t.dataset.page === String(current));
+        });
+    }
+
+    pagerEl.addEventListener("submit", (e) => {
+        e.preventDefault();
+        const n = Math.min(Math.max(parseInt(pageInput.value, 10) || 1, 1), Number(pageInput.max) || 1);
+        gotoPage(n);
+        pageInput.blur();
+    });
+
+    // Called once pages are laid out: after the first paginate and after
+    // every repaint. Thumbnails are rebuilt only while they're showing.
+    function refreshSidebar() {
+        thumbsStale = true;
+        updatePager();
+        if (sidebarEl.hidden) return;
+        refreshOutline();
+        if (!thumbsEl.hidden) buildThumbs();
+    }
+
+    let pagerQueued = false;
+    function onFrameScroll() {
+        if (pagerQueued) return;
+        pagerQueued = true;
+        requestAnimationFrame(() => {
+            pagerQueued = false;
+            updatePager();
+        });
+    }
+
+    // View toolbar: zoom (fit width, fit page, 100%), single pages or
+    // facing-page spreads, and layout guides. shell.html applies it through
+    // __mdocView; the choice is kept per document, under the key the page
+    // carries in data-doc.
+    const viewEl = document.getElementById("view");
+    const guidesBtn = document.getElementById("btn-guides");
+    const viewKey = "mdoc.view." + document.body.dataset.doc;
+    const view = { zoom: "width", spread: false, guides: false };
+    try { Object.assign(view, JSON.parse(localStorage.getItem(viewKey))); } catch (_) {}
+
+    function setView(v) {
+        Object.assign(view, v);
+        try { localStorage.setItem(viewKey, JSON.stringify(view)); } catch (_) {}
+        showView();
+        if (iframeReady()) {
+            frame.contentWindow.__mdocView(view);
+            updatePager();
+        }
+    }
+
+    function showView() {
+        viewEl.querySelectorAll("[data-zoom]").forEach(b => {
+            b.classList.toggle("active", b.dataset.zoom === view.zoom);
+        });
+        viewEl.querySelectorAll("[data-spread]").forEach(b => {
+            b.classList.toggle("active", Boolean(b.dataset.spread) === view.spread);
+        });
+        guidesBtn.setAttribute("aria-pressed", String(view.guides));
+    }
+
+    viewEl.querySelectorAll("[data-zoom]").forEach(b => {
+        b.addEventListener("click", () => setView({ zoom: b.dataset.zoom }));
+    });
+    viewEl.querySelectorAll("[data-spread]").forEach(b => {
+        b.addEventListener("click", () => setView({ spread: Boolean(b.dataset.spread) }));
+    });
+    guidesBtn.addEventListener("click", () => setView({ guides: !view.guides }));
+    showView();
+
+    frame.addEventListener("load", async () => {
+        if (iframeReady()) {
+            frame.contentWindow.__mdocView(view);
+            hideError();
+            refreshStatus();
+            const win = frame.contentWindow;
+            win.addEventListener("scroll", onFrameScroll, { passive: true });
+            Promise.resolve(win.__mdocPagedDone).then(refreshSidebar, () => {});
+            return;
+        }
+        // The initial /preview render failed: fetch the structured error
+        // so it shows in the overlay rather than as a bare error page.
+        try {
+            const res = await fetch("/preview/body", { cache: "no-store" });
+            if (!res.ok) await showFetchError(res);
+        } catch (_) {}
     });
 
     let ws = null;
@@ -95,6 +417,9 @@
             let msg;
             try { msg = JSON.parse(evt.data); } catch (_) { return; }
             if (msg.event === "reload") repaint();
+            if (msg.event === "goto" && iframeReady()) {
+                frame.contentWindow.__mdocGoto(msg.file, msg.line);
+            }
         };
     }
 
@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/hinkolas/mdoc/internal/document"
@@ -68,21 +69,30 @@ func Export(doc *document.Document, thm *theme.Theme, opts Options) (*Result, er
 	zw := zip.NewWriter(f)
 	res := &Result{OutputPath: absOut}
 
-	// Global `:::include` partials live in ~/.config/mdoc/includes, outside the
+	// Key `:::include` partials live in an include search dir —
+	// ~/.config/mdoc/includes or a project's includes/ — usually outside the
 	// document tree, so they have no place in a portable archive. They are
 	// inlined into the bundled files instead (FlattenGlobalIncludes); local path
-	// includes stay as separate files. includesDir lets the loop below tell the
+	// includes stay as separate files. includeDirs lets the loop below tell the
 	// two apart by location.
-	includesDir, _ := paths.IncludesDir()
+	includeDirs := document.IncludeSearchDirs(doc.Project)
+
+	// Where step 2 stores the theme, and the `theme` value that finds it there
+	// once unpacked.
+	themeEntry, themeValue := bundledTheme(thm)
 
 	// 1. The source document, at the bundle root with its original name so the
-	//    unpacked layout works as a normal mdoc project, with global includes
-	//    flattened in so it stays self-contained.
+	//    unpacked layout works as a normal mdoc project, with global includes,
+	//    `extends` base configs and the mdoc.yaml project's defaults and
+	//    references flattened in so it stays self-contained.
 	docEntry := filepath.Base(doc.Path)
-	docBody, err := document.FlattenGlobalIncludes(doc.Path)
+	docBody, err := document.FlattenGlobalIncludes(doc.Path, doc.Project)
 	if err != nil {
 		return nil, fmt.Errorf("flatten document: %w", err)
 	}
+	if docBody, err = document.InlineConfig(docBody, doc, themeValue); err != nil {
+		return nil, fmt.Errorf("inline config: %w", err)
+	}
 	if err := addBytes(zw, docEntry, doc.Path, []byte(docBody)); err != nil {
 		return nil, fmt.Errorf("add document: %w", err)
 	}
@@ -100,14 +110,14 @@ func Export(doc *document.Document, thm *theme.Theme, opts Options) (*Result, er
 			continue // a file included from two places is stored once
 		}
 		seen[inc] = true
-		if includesDir != "" && isUnder(includesDir, inc) {
-			continue // global partial: inlined, not stored as a file
-		}
 		rel, err := filepath.Rel(doc.Dir, inc)
 		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			if slices.ContainsFunc(includeDirs, func(dir string) bool { return isUnder(dir, inc) }) {
+				continue // key partial: inlined, not stored as a file
+			}
 			return nil, fmt.Errorf("included file %s is outside the document directory %s; bundling requires includes under it", inc, doc.Dir)
 		}
-		body, err := document.FlattenGlobalIncludes(inc)
+		body, err := document.FlattenGlobalIncludes(inc, doc.Project)
 		if err != nil {
 			return nil, fmt.Errorf("flatten include %s: %w", rel, err)
 		}
@@ -121,8 +131,7 @@ func Export(doc *document.Document, thm *theme.Theme, opts Options) (*Result, er
 	// 2. The resolved theme. Always included regardless of whether it
 	//    came from the project's themes/ or the user's config dir — a
 	//    bundle should be self-contained.
-	if thm.Path != "" {
-		themeEntry := filepath.ToSlash(filepath.Join("themes", thm.Name+".html"))
+	if themeEntry != "" {
 		if err := addFile(zw, themeEntry, thm.Path); err != nil {
 			return nil, fmt.Errorf("add theme: %w", err)
 		}
@@ -156,12 +165,52 @@ func Export(doc *document.Document, thm *theme.Theme, opts Options) (*Result, er
 		}
 	}
 
+	// 4. Data files loaded into `data`, at their path relative to the root so
+	//    the frontmatter's relative paths keep resolving. Like local includes,
+	//    they must live under the document directory.
+	for _, file := range doc.DataFiles {
+		rel, err := filepath.Rel(doc.Dir, file)
+		if err != nil || !isUnder(doc.Dir, file) {
+			return nil, fmt.Errorf("data file %s is outside the document directory %s; bundling requires data files under it", file, doc.Dir)
+		}
+		entry := filepath.ToSlash(rel)
+		if slices.Contains(res.Entries, entry) {
+			continue // already stored with assets/
+		}
+		if err := addFile(zw, entry, file); err != nil {
+			return nil, fmt.Errorf("add data file %s: %w", rel, err)
+		}
+		res.Entries = append(res.Entries, entry)
+	}
+
 	if err := zw.Close(); err != nil {
 		return nil, fmt.Errorf("finalize bundle: %w", err)
 	}
 	return res, nil
 }
 
+// bundledTheme returns the bundle entry a theme file is stored at —
+// themes/<name>.html, where a key keeps its name ("a::b" becomes a/b) and a
+// path theme its file name — and the relative `theme` path that loads it from
+// the unpacked bundle. A built-in theme has no file: entry is empty and value
+// is its bare key.
+func bundledTheme(thm *theme.Theme) (entry, value string) {
+	if thm.Path == "" {
+		return "", thm.Name
+	}
+	name := thm.Name
+	switch paths.Classify(name) {
+	case paths.KindScopedKey:
+		if rel, err := paths.ScopedKeyToRelpath(name); err == nil {
+			name = rel
+		}
+	case paths.KindPath:
+		name = strings.TrimSuffix(filepath.Base(thm.Path), filepath.Ext(thm.Path))
+	}
+	entry = filepath.ToSlash(filepath.Join("themes", name+".html"))
+	return entry, "./" + entry
+}
+
 // addFile copies sourcePath into the zip at bundlePath, preserving mtime
 // and a basic mode. Names are normalized to forward slashes per the zip
 // spec so the bundle is portable across operating systems.
@@ -215,7 +264,7 @@ func addBytes(zw *zip.Writer, bundlePath, metaSource string, content []byte) err
 }
 
 // isUnder reports whether path is dir itself or lies within it, after cleaning
-// both. Used to tell global include partials (under the user includes dir) apart
+// both. Used to tell key include partials (under an include search dir) apart
 // from local includes under the document.
 func isUnder(dir, path string) bool {
 	rel, err := filepath.Rel(dir, path)
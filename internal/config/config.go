@@ -0,0 +1,319 @@
+// Package config loads mdoc's settings files: the per-user
+// ~/.config/mdoc/config.yaml (see paths.ConfigFile), which it can also edit,
+// and the per-project mdoc.yaml (see FindProject). The user file has three
+// sections:
+//
+//	defaults:          # frontmatter defaults merged under every document
+//	  author: "Jane Doe"
+//	  labels: {figure: Abbildung, table: Tabelle}
+//	  numbering: {enabled: true}
+//	preview:
+//	  port: 7768       # default for `mdoc open --port`
+//	  editor: "code -g {file}:{line}"  # Ctrl-click in the preview opens the source
+//	output:
+//	  dir: out         # where `mdoc print` / `mdoc bundle` write by default
+//
+// Precedence, lowest to highest: mdoc's built-in defaults, this file, the
+// project's mdoc.yaml, the document's own frontmatter, and finally
+// command-line flags. `defaults` is
+// kept as raw YAML so this package needn't know the frontmatter schema —
+// internal/document decodes it into document.Config before the frontmatter, so
+// maps merge key by key while scalars and lists from the document win outright.
+//
+// A missing file is the normal case and means "no user settings"; a file that
+// exists but won't parse is an error, so a typo doesn't silently drop settings.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/hinkolas/mdoc/internal/paths"
+)
+
+// Config is the typed view of config.yaml.
+type Config struct {
+	Defaults yaml.MapSlice `yaml:"defaults"`
+	Preview  Preview       `yaml:"preview"`
+	Output   Output        `yaml:"output"`
+}
+
+// Preview holds defaults for `mdoc open`.
+type Preview struct {
+	// Port is the preview server port. nil leaves the flag default (7768);
+	// 0 picks a free port, as with --port 0.
+	Port *int `yaml:"port"`
+	// Editor is the command a Ctrl-click in the preview runs to open the
+	// clicked block's source, with {file} and {line} placeholders, e.g.
+	// "code -g {file}:{line}". Empty runs $VISUAL or $EDITOR when it names a
+	// known GUI editor; a terminal editor needs this set.
+	Editor string `yaml:"editor"`
+}
+
+// Output holds defaults for where generated files are written.
+type Output struct {
+	// Dir is the directory `mdoc print` and `mdoc bundle` write into when no
+	// --output is given. A relative Dir resolves from the document's directory
+	// (so "out" means an out/ folder next to each document); "~" expands to the
+	// home directory. Empty keeps the default of writing next to the source.
+	Dir string `yaml:"dir"`
+}
+
+// Load reads the user config file. A missing file yields an empty Config and
+// no error.
+func Load() (*Config, error) {
+	f, err := Open()
+	if err != nil {
+		return nil, err
+	}
+	return f.Config()
+}
+
+// DecodeDefaults decodes the `defaults` section into v (typically a
+// *document.Config). Fields already set on v that the section doesn't mention
+// are left alone, and maps are merged into rather than replaced.
+func (c *Config) DecodeDefaults(v any) error {
+	if err := decodeSection(c.Defaults, v); err != nil {
+		return fmt.Errorf("config defaults: %w", err)
+	}
+	return nil
+}
+
+// decodeSection decodes a raw YAML section into v on top of whatever v already
+// holds (yaml leaves absent fields alone and merges into existing maps).
+func decodeSection(m yaml.MapSlice, v any) error {
+	if len(m) == 0 {
+		return nil
+	}
+	raw, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(raw, v)
+}
+
+// CheckDefaults strictly decodes the `defaults` section into v, reporting keys
+// v has no field for. `mdoc config set` uses it to reject a misspelled key
+// before it is written.
+func (c *Config) CheckDefaults(v any) error {
+	if len(c.Defaults) == 0 {
+		return nil
+	}
+	raw, err := yaml.Marshal(c.Defaults)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(raw, v)
+}
+
+// OutputPath returns where a generated file for the document at docPath goes
+// when Output.Dir is set: <dir>/<basename><ext>. It returns "" when no output
+// directory is configured, so callers fall back to their own default.
+func (c *Config) OutputPath(docPath, ext string) string {
+	dir := c.Output.Dir
+	if dir == "" {
+		return ""
+	}
+	dir = expandPath(dir, filepath.Dir(docPath))
+	base := filepath.Base(docPath)
+	return filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+ext)
+}
+
+// File is config.yaml as an ordered key tree, for `mdoc config get/set/list`.
+// Keys are dotted paths ("defaults.labels.figure"). Saving rewrites the file
+// from the tree, so comments in a hand-edited file are not preserved.
+type File struct {
+	Path string
+	root yaml.MapSlice
+}
+
+// Entry is one leaf of the tree as listed by List.
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// Open reads the user config file as an editable tree. A missing file yields
+// an empty tree that Save will create.
+func Open() (*File, error) {
+	path, err := paths.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("locate config: %w", err)
+	}
+	f := &File{Path: path}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := yaml.Unmarshal(raw, &f.root); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", paths.Display(path), err)
+	}
+	return f, nil
+}
+
+// Config decodes the tree into the typed Config, rejecting unknown sections or
+// settings (everything except the free-form `defaults`).
+func (f *File) Config() (*Config, error) {
+	var c Config
+	if len(f.root) == 0 {
+		return &c, nil
+	}
+	raw, err := yaml.Marshal(f.root)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(raw, &c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", paths.Display(f.Path), err)
+	}
+	return &c, nil
+}
+
+// Get returns the value at a dotted key: a scalar, a list, or a whole section.
+func (f *File) Get(key string) (any, bool) {
+	var cur any = f.root
+	for _, seg := range strings.Split(key, ".") {
+		m, ok := cur.(yaml.MapSlice)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = lookup(m, seg); !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Set stores value at a dotted key, creating intermediate sections as needed.
+// It fails when a segment along the way already holds a non-section value.
+func (f *File) Set(key string, value any) error {
+	segs := strings.Split(key, ".")
+	for _, seg := range segs {
+		if seg == "" {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+	root, err := set(f.root, segs, value, "")
+	if err != nil {
+		return err
+	}
+	f.root = root
+	return nil
+}
+
+func set(m yaml.MapSlice, segs []string, value any, prefix string) (yaml.MapSlice, error) {
+	seg := segs[0]
+	if len(segs) == 1 {
+		for i := range m {
+			if fmt.Sprint(m[i].Key) == seg {
+				m[i].Value = value
+				return m, nil
+			}
+		}
+		return append(m, yaml.MapItem{Key: seg, Value: value}), nil
+	}
+	for i := range m {
+		if fmt.Sprint(m[i].Key) != seg {
+			continue
+		}
+		child, ok := m[i].Value.(yaml.MapSlice)
+		if !ok && m[i].Value != nil {
+			return nil, fmt.Errorf("%s%s is a value, not a section", prefix, seg)
+		}
+		child, err := set(child, segs[1:], value, prefix+seg+".")
+		if err != nil {
+			return nil, err
+		}
+		m[i].Value = child
+		return m, nil
+	}
+	child, err := set(nil, segs[1:], value, prefix+seg+".")
+	if err != nil {
+		return nil, err
+	}
+	return append(m, yaml.MapItem{Key: seg, Value: child}), nil
+}
+
+// List flattens the tree into dotted keys and formatted values, in file order.
+func (f *File) List() []Entry {
+	var out []Entry
+	var walk func(m yaml.MapSlice, prefix string)
+	walk = func(m yaml.MapSlice, prefix string) {
+		for _, item := range m {
+			key := prefix + fmt.Sprint(item.Key)
+			if child, ok := item.Value.(yaml.MapSlice); ok {
+				walk(child, key+".")
+				continue
+			}
+			out = append(out, Entry{Key: key, Value: Format(item.Value)})
+		}
+	}
+	walk(f.root, "")
+	return out
+}
+
+// Save writes the tree back to Path, creating the config directory if needed.
+func (f *File) Save() error {
+	raw, err := yaml.Marshal(f.root)
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	if err := os.WriteFile(f.Path, raw, 0o644); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
+
+// ParseValue reads a command-line value as YAML, so `true`, `7768` and
+// `[a, b]` become a bool, a number and a list, while anything else stays a
+// string. An empty argument is the empty string.
+func ParseValue(s string) any {
+	var v any
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil || v == nil {
+		return s
+	}
+	return v
+}
+
+// Format renders a value for display: scalars as-is, lists in YAML flow style
+// (`[a, b]`), and sections as an indented YAML block.
+func Format(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case []any:
+		parts := make([]string, len(t))
+		for i, e := range t {
+			parts[i] = Format(e)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case yaml.MapSlice:
+		raw, err := yaml.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return strings.TrimRight(string(raw), "\n")
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func lookup(m yaml.MapSlice, key string) (any, bool) {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
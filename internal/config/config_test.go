@@ -0,0 +1,163 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setup points the user config dir at a temp dir, optionally seeding
+// config.yaml, and returns the config file path.
+func setup(t *testing.T, content string) string {
+	t.Helper()
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	path := filepath.Join(cfg, "mdoc", "config.yaml")
+	if content != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	setup(t, "")
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("missing config should not error: %v", err)
+	}
+	if c.Preview.Port != nil || c.Output.Dir != "" || len(c.Defaults) != 0 {
+		t.Errorf("expected an empty config, got %+v", c)
+	}
+}
+
+func TestLoadRejectsUnknownSection(t *testing.T) {
+	setup(t, "previw:\n  port: 1\n")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an error for an unknown section")
+	}
+}
+
+func TestSetGetListRoundTrip(t *testing.T) {
+	path := setup(t, "defaults:\n  author: Jane\n")
+	f, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range [][2]string{
+		{"defaults.labels.figure", "Abbildung"},
+		{"preview.port", "0"},
+		{"defaults.tags", "[a, b]"},
+	} {
+		if err := f.Set(kv[0], ParseValue(kv[1])); err != nil {
+			t.Fatalf("Set(%s): %v", kv[0], err)
+		}
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("config not written: %v", err)
+	}
+
+	f, err = Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := f.Get("defaults.labels.figure"); !ok || Format(v) != "Abbildung" {
+		t.Errorf("Get(defaults.labels.figure) = %v, %v", v, ok)
+	}
+	want := []Entry{
+		{"defaults.author", "Jane"},
+		{"defaults.labels.figure", "Abbildung"},
+		{"defaults.tags", "[a, b]"},
+		{"preview.port", "0"},
+	}
+	got := f.List()
+	if len(got) != len(want) {
+		t.Fatalf("List() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("List()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	c, err := f.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Preview.Port == nil || *c.Preview.Port != 0 {
+		t.Errorf("preview.port = %v, want 0", c.Preview.Port)
+	}
+}
+
+func TestSetThroughValueFails(t *testing.T) {
+	setup(t, "defaults:\n  author: Jane\n")
+	f, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("defaults.author.name", "x"); err == nil {
+		t.Fatal("expected an error setting a key below a scalar")
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	c := &Config{}
+	if got := c.OutputPath("/docs/report.md", ".pdf"); got != "" {
+		t.Errorf("no output.dir: got %q, want empty", got)
+	}
+	c.Output.Dir = "out"
+	if got, want := c.OutputPath("/docs/report.md", ".pdf"), filepath.Join("/docs", "out", "report.pdf"); got != want {
+		t.Errorf("relative dir: got %q, want %q", got, want)
+	}
+	c.Output.Dir = "/abs/pdf"
+	if got, want := c.OutputPath("/docs/report.md", ".mdoc"), filepath.Join("/abs/pdf", "report.mdoc"); got != want {
+		t.Errorf("absolute dir: got %q, want %q", got, want)
+	}
+}
+
+func TestFindProjectWalksUp(t *testing.T) {
+	root := t.TempDir()
+	content := "defaults:\n  theme: ./themes/company.html\nreferences: refs.yaml\nincludes: [shared]\n"
+	if err := os.WriteFile(filepath.Join(root, ProjectFileName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deep := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := FindProject(deep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil || p.Dir != root {
+		t.Fatalf("project = %+v, want one rooted at %s", p, root)
+	}
+	if got, want := p.Defaults[0].Value, filepath.Join(root, "themes", "company.html"); got != want {
+		t.Errorf("defaults.theme = %v, want %v", got, want)
+	}
+	if got, want := p.ReferencesPath(), filepath.Join(root, "refs.yaml"); got != want {
+		t.Errorf("ReferencesPath = %q, want %q", got, want)
+	}
+	dirs := p.IncludeDirs()
+	if len(dirs) != 2 || dirs[0] != filepath.Join(root, "includes") || dirs[1] != filepath.Join(root, "shared") {
+		t.Errorf("IncludeDirs = %v", dirs)
+	}
+}
+
+func TestFindProjectRejectsUnknownKey(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ProjectFileName), []byte("default:\n  author: x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindProject(root); err == nil {
+		t.Fatal("expected an error for a misspelled section")
+	}
+}
@@ -0,0 +1,161 @@
+package config
+
+// A project config is an mdoc.yaml file that applies to every document below
+// the directory it sits in, found by walking up from the document's directory
+// (the way git finds .git). It is the multi-document analogue of the user
+// config: a docs folder with thirty specs declares its shared theme, labels and
+// bibliography once instead of in every frontmatter.
+//
+//	defaults:              # frontmatter defaults for documents in the project
+//	  theme: company       # bare keys resolve in <project>/themes first
+//	  labels: {figure: Abbildung}
+//	references: refs.yaml  # bibliography file, shared by every document
+//	includes:              # extra dirs searched for bare `:::include` keys
+//	  - shared/partials
+//
+// Next to mdoc.yaml, a project may ship its own themes/ and includes/
+// directories. Bare and scoped keys resolve there before the user config dir,
+// so a project needn't pollute ~/.config/mdoc or hard-code ./themes/x.html
+// paths. Relative paths in the file resolve from the project directory.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/hinkolas/mdoc/internal/paths"
+)
+
+// ProjectFileName is the name of the project config file.
+const ProjectFileName = "mdoc.yaml"
+
+// Project is a discovered mdoc.yaml.
+type Project struct {
+	// Path is the absolute path of the mdoc.yaml file; Dir is its directory,
+	// the project root.
+	Path string `yaml:"-"`
+	Dir  string `yaml:"-"`
+
+	Defaults yaml.MapSlice `yaml:"defaults"`
+	// References names a YAML (or JSON) file holding a list of bibliography
+	// entries in the frontmatter `references` shape.
+	References string `yaml:"references"`
+	// Includes lists extra directories searched for bare and scoped
+	// `:::include` keys, after the project's own includes/ directory.
+	Includes []string `yaml:"includes"`
+}
+
+// FindProject walks up from dir looking for an mdoc.yaml and loads the first
+// one found. It returns nil and no error when there is none.
+func FindProject(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		raw, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			p := &Project{Path: path, Dir: dir}
+			if err := yaml.UnmarshalStrict(raw, p); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", paths.Display(path), err)
+			}
+			p.absTheme()
+			return p, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("read %s: %w", paths.Display(path), err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// DecodeDefaults decodes the `defaults` section into v, on top of what v
+// already holds (see Config.DecodeDefaults).
+func (p *Project) DecodeDefaults(v any) error {
+	if err := decodeSection(p.Defaults, v); err != nil {
+		return fmt.Errorf("%s defaults: %w", paths.Display(p.Path), err)
+	}
+	return nil
+}
+
+// ThemesDir is the project's own themes directory, <Dir>/themes.
+func (p *Project) ThemesDir() string { return filepath.Join(p.Dir, "themes") }
+
+// IncludeDirs returns the directories searched for bare and scoped include
+// keys, in order: <Dir>/includes, then each configured Includes entry.
+func (p *Project) IncludeDirs() []string {
+	dirs := []string{filepath.Join(p.Dir, "includes")}
+	for _, d := range p.Includes {
+		dirs = append(dirs, p.resolve(d))
+	}
+	return dirs
+}
+
+// ReferencesPath is the absolute path of the references file, or "" when none
+// is configured.
+func (p *Project) ReferencesPath() string {
+	if p.References == "" {
+		return ""
+	}
+	return p.resolve(p.References)
+}
+
+// resolve makes a project-relative path absolute, expanding a leading "~".
+func (p *Project) resolve(path string) string {
+	return expandPath(path, p.Dir)
+}
+
+// absTheme anchors a path-valued `defaults.theme` at the project directory.
+// Defaults are decoded as if they were frontmatter, and a frontmatter theme path
+// resolves from the document's directory; anchoring it here keeps
+// `theme: ./themes/x.html` meaning the project's file for documents in any
+// subdirectory.
+func (p *Project) absTheme() { AnchorTheme(p.Defaults, p.Dir) }
+
+// AnchorTheme rewrites a relative path-valued `theme` entry of a frontmatter-
+// shaped map to an absolute path resolved from dir. Keys and built-in names are
+// left alone.
+func AnchorTheme(m yaml.MapSlice, dir string) {
+	for i, item := range m {
+		if fmt.Sprint(item.Key) != "theme" {
+			continue
+		}
+		if s, ok := item.Value.(string); ok && paths.Classify(s) == paths.KindPath {
+			m[i].Value = expandPath(s, dir)
+		}
+	}
+}
+
+// expandPath resolves path against base: "~" expands to the home directory and
+// a relative path is joined onto base.
+func expandPath(path, base string) string {
+	if rest, ok := cutHome(path); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	return filepath.Clean(path)
+}
+
+// cutHome strips a leading "~" (alone or followed by a separator).
+func cutHome(path string) (string, bool) {
+	if path == "~" {
+		return "", true
+	}
+	if len(path) >= 2 && path[0] == '~' && (path[1] == '/' || path[1] == filepath.Separator) {
+		return path[2:], true
+	}
+	return "", false
+}
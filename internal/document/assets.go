@@ -0,0 +1,206 @@
+package document
+
+// An included file writes its relative image and link URLs against its own
+// directory, but the combined body renders as if it all lived in the root
+// document's directory. So while splicing, each included line has those URLs
+// rebased onto the root: `img/plot.svg` in chapters/02/method.md becomes
+// `chapters/02/img/plot.svg`. A file outside the root's tree — `../shared/`,
+// or a global partial in the includes dir — can't be reached by a relative
+// path, so its URLs point at `_/file/<absolute dir>/…` instead. The files
+// those name are recorded in Document.Assets, and the preview and print
+// servers serve exactly those through AssetFile.
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// externalAssets prefixes rebased URLs into a directory outside the root
+// document's tree.
+const externalAssets = "_/file/"
+
+var (
+	// inlineURL matches the destination of an inline link or image: `](dest`.
+	inlineURL = regexp.MustCompile(`\]\((<[^>\n]*>|[^)\s]+)`)
+	// refDefURL matches a link reference definition: `[label]: dest`.
+	refDefURL = regexp.MustCompile(`^( {0,3}\[[^\]]+\]:[ \t]*)(<[^>\n]*>|\S+)`)
+	// htmlURL matches a src or href attribute in raw HTML.
+	htmlURL = regexp.MustCompile(`\b((?:src|href)[ \t]*=[ \t]*)("[^"]*"|'[^']*')`)
+)
+
+// assetBase returns the URL prefix that rebases a relative URL written in a
+// file in dir onto rootDir, or "" when dir is rootDir itself.
+func assetBase(rootDir, dir string) string {
+	rel, err := filepath.Rel(rootDir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return externalAssets + strings.TrimPrefix(filepath.ToSlash(dir), "/")
+	}
+	if rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// rebaseURLs rewrites the relative URLs on one markdown line — inline links
+// and images, reference definitions, and src/href attributes of raw HTML — to
+// resolve under base. Code spans are left alone. When base is outside the root
+// document's tree it also returns the absolute paths of the files the rebased
+// URLs name.
+func rebaseURLs(line, base string) (string, []string) {
+	var external []string
+	rebase := func(dest string) string {
+		u := rebaseURL(dest, base)
+		if u != dest && strings.HasPrefix(base, externalAssets) {
+			if file, ok := externalFile(u); ok {
+				external = append(external, file)
+			}
+		}
+		return u
+	}
+	if m := refDefURL.FindStringSubmatchIndex(line); m != nil {
+		return line[:m[3]] + rebase(line[m[4]:m[5]]) + line[m[5]:], external
+	}
+	line = outsideCode(line, func(s string) string {
+		s = inlineURL.ReplaceAllStringFunc(s, func(m string) string {
+			return "](" + rebase(m[2:])
+		})
+		return htmlURL.ReplaceAllStringFunc(s, func(m string) string {
+			sub := htmlURL.FindStringSubmatch(m)
+			quote := sub[2][:1]
+			return sub[1] + quote + rebase(sub[2][1:len(sub[2])-1]) + quote
+		})
+	})
+	return line, external
+}
+
+// externalFile returns the absolute path of the file a rebased `_/file/…` URL
+// names, as the servers see it requested: without `<…>` brackets, query and
+// fragment, and percent-decoded.
+func externalFile(u string) (string, bool) {
+	u = strings.TrimSuffix(strings.TrimPrefix(u, "<"), ">")
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	ext, found := strings.CutPrefix(u, externalAssets)
+	if !found {
+		return "", false
+	}
+	if p, err := url.PathUnescape(ext); err == nil {
+		ext = p
+	}
+	return externalPath(ext), true
+}
+
+// externalPath turns the part of a `_/file/` URL after the prefix back into a
+// clean absolute path.
+func externalPath(ext string) string {
+	abs := filepath.FromSlash(ext)
+	if filepath.VolumeName(abs) == "" {
+		abs = string(filepath.Separator) + abs
+	}
+	return filepath.Clean(abs)
+}
+
+// rebaseURL rebases one link destination, keeping `<…>` brackets, a query and
+// a fragment. Absolute URLs, root-relative paths, bare fragments and template
+// expressions are returned as they are.
+func rebaseURL(dest, base string) string {
+	u, angle := dest, false
+	if strings.HasPrefix(u, "<") && strings.HasSuffix(u, ">") {
+		u, angle = u[1:len(u)-1], true
+	}
+	if !isRelativeURL(u) {
+		return dest
+	}
+	p, rest := u, ""
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		p, rest = u[:i], u[i:]
+	}
+	u = path.Join(base, p) + rest
+	if angle {
+		return "<" + u + ">"
+	}
+	return u
+}
+
+// isRelativeURL reports whether u is a path relative to the file it's in.
+func isRelativeURL(u string) bool {
+	if u == "" || strings.ContainsAny(u[:1], "/#?") || strings.Contains(u, "{{") {
+		return false
+	}
+	// A scheme (http:, mailto:, data:) comes before any slash.
+	i := strings.IndexAny(u, ":/?#")
+	return i < 0 || u[i] != ':'
+}
+
+// outsideCode applies fn to the parts of line outside inline code spans.
+func outsideCode(line string, fn func(string) string) string {
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+		n := 0
+		for i+n < len(line) && line[i+n] == '`' {
+			n++
+		}
+		end := closingTicks(line, i+n, n)
+		if end < 0 {
+			i += n
+			continue
+		}
+		b.WriteString(fn(line[start:i]))
+		b.WriteString(line[i:end])
+		start, i = end, end
+	}
+	b.WriteString(fn(line[start:]))
+	return b.String()
+}
+
+// closingTicks returns the end of the run of exactly n backticks at or after
+// from that closes a code span, or -1.
+func closingTicks(line string, from, n int) int {
+	for i := from; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(line) && line[j] == '`' {
+			j++
+		}
+		if j-i == n {
+			return j
+		}
+		i = j
+	}
+	return -1
+}
+
+// AssetFile maps a URL path relative to a document in dir — what a relative
+// reference in its rendered body requests from the preview or print server —
+// to the file it names. assets are the files outside dir the body's rebased
+// `_/file/…` URLs name (see Document.Assets): only those exact files are
+// reachable that way. ok is false for anything else outside dir.
+func AssetFile(dir string, assets []string, rel string) (string, bool) {
+	if ext, found := strings.CutPrefix(rel, externalAssets); found {
+		abs := externalPath(ext)
+		if !slices.Contains(assets, abs) {
+			return "", false
+		}
+		return abs, true
+	}
+	abs := filepath.Join(dir, filepath.FromSlash(rel))
+	return abs, within(dir, abs)
+}
+
+// within reports whether path is dir or inside it. Both must be clean.
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,201 @@
+package document
+
+// Data files let `data` values live outside the frontmatter. A top-level `data`
+// entry whose value is a path naming a .yaml/.yml, .json or .csv file is
+// replaced by the file's parsed content. The path is written either as an
+// explicit relative path starting with `./`, `../` or `~/`, or as
+// `{file: <path>}`:
+//
+//	data:
+//	  items: ./items.csv       # {{range .Data.items}}{{.name}}: {{.price}}{{end}}
+//	  meta: {file: meta.json}  # {{.Data.meta.invoice}}
+//
+// Either form keeps an ordinary string that merely looks like a file name —
+// "report.csv", a URL to a spec.json — a string. YAML and JSON load as
+// whatever they hold (maps, lists, scalars), with maps keyed by strings. A CSV
+// loads as a list of rows, each a map from the header row's column names to the
+// cell text. Relative paths resolve from the document's directory, and "~" or
+// "~/…" from the home directory.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/hinkolas/mdoc/internal/paths"
+)
+
+// dataExts are the file extensions a `data` value must end in to be loaded.
+var dataExts = []string{".yaml", ".yml", ".json", ".csv"}
+
+// dataPathPrefixes are what a string `data` value must start with to be read
+// as a data file.
+var dataPathPrefixes = []string{"./", "../", "~/"}
+
+// dataFile returns the path a `data` value names when it is a data-file
+// reference: a string starting with one of dataPathPrefixes, or a map whose only
+// key is "file", holding a path with a data-file extension. Anything else is
+// ordinary data.
+func dataFile(v any) (string, bool) {
+	var file any
+	switch m := v.(type) {
+	case string:
+		if !slices.ContainsFunc(dataPathPrefixes, func(p string) bool { return strings.HasPrefix(m, p) }) {
+			return "", false
+		}
+		file = m
+	case map[any]any:
+		if len(m) != 1 {
+			return "", false
+		}
+		file = m["file"]
+	case map[string]any:
+		if len(m) != 1 {
+			return "", false
+		}
+		file = m["file"]
+	}
+	s, ok := file.(string)
+	if !ok || !slices.Contains(dataExts, strings.ToLower(filepath.Ext(s))) {
+		return "", false
+	}
+	return s, true
+}
+
+// loadDataFiles replaces every data-file value in data with the file's content
+// and returns the absolute paths of the files read, sorted. dir is the
+// directory relative paths resolve from.
+func loadDataFiles(data map[string]any, dir string) ([]string, error) {
+	var files []string
+	for key, v := range data {
+		path, ok := dataFile(v)
+		if !ok {
+			continue
+		}
+		abs := path
+		if path == "~" || strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				abs = filepath.Join(home, path[1:])
+			}
+		}
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(dir, abs)
+		}
+		abs = filepath.Clean(abs)
+		content, err := readDataFile(abs)
+		if err != nil {
+			return nil, fmt.Errorf("data.%s: %w", key, err)
+		}
+		data[key] = content
+		files = append(files, abs)
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// readDataFile parses one data file by its extension.
+func readDataFile(path string) (any, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		v, err = parseCSV(raw)
+	case ".json":
+		err = json.Unmarshal(raw, &v)
+	default:
+		err = yaml.Unmarshal(raw, &v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", paths.Display(path), err)
+	}
+	return stringKeys(v), nil
+}
+
+// parseCSV reads a CSV with a header row into one map per data row. A leading
+// byte-order mark, as spreadsheet exports write, is dropped.
+func parseCSV(raw []byte) ([]any, error) {
+	r := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(raw), "\ufeff")))
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	rows := []any{}
+	if len(records) == 0 {
+		return rows, nil
+	}
+	header := records[0]
+	seen := make(map[string]bool, len(header))
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+		if seen[header[i]] {
+			return nil, fmt.Errorf("duplicate column %q in the header row", header[i])
+		}
+		seen[header[i]] = true
+	}
+	for _, rec := range records[1:] {
+		row := make(map[string]any, len(header))
+		for i, col := range header {
+			row[col] = rec[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// stringKeys converts the map[interface{}]interface{} values yaml.v2 produces
+// into map[string]any, recursively, so YAML data looks like JSON data to
+// templates and template functions.
+func stringKeys(v any) any {
+	switch t := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return m
+	case map[string]any:
+		for k, e := range t {
+			t[k] = stringKeys(e)
+		}
+		return t
+	case []any:
+		for i, e := range t {
+			t[i] = stringKeys(e)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// ReadRecords reads a data file as the record list of a mail merge (`mdoc print
+// --each`): the rows of a CSV, or a YAML/JSON list of maps.
+func ReadRecords(path string) ([]map[string]any, error) {
+	if !slices.Contains(dataExts, strings.ToLower(filepath.Ext(path))) {
+		return nil, fmt.Errorf("%s: records must be a .csv, .json, .yaml or .yml file", paths.Display(path))
+	}
+	v, err := readDataFile(path)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a list of records", paths.Display(path))
+	}
+	records := make([]map[string]any, len(list))
+	for i, item := range list {
+		if records[i], ok = item.(map[string]any); !ok {
+			return nil, fmt.Errorf("%s: record %d is not a map of fields", paths.Display(path), i+1)
+		}
+	}
+	return records, nil
+}
@@ -4,25 +4,45 @@
 package document
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
-	"github.com/adrg/frontmatter"
+	"gopkg.in/yaml.v2"
+
+	"github.com/hinkolas/mdoc/internal/config"
+	"github.com/hinkolas/mdoc/internal/paths"
 )
 
-// Config is the YAML frontmatter shape.
+// Config is the YAML frontmatter shape. Subtitle through Abstract are the
+// title page fields that `:::titlepage` lays out and any theme can read; Logo is
+// an image path or URL, resolved like an image in the body, and Abstract is
+// markdown.
 type Config struct {
-	MDoc       bool              `yaml:"mdoc"`
-	Theme      string            `yaml:"theme"`
-	Title      string            `yaml:"title"`
-	Author     string            `yaml:"author"`
-	Tags       []string          `yaml:"tags"`
-	Page       Page              `yaml:"page"`
-	Data       map[string]any    `yaml:"data"`
-	References []Reference       `yaml:"references"`
-	Numbering  Numbering         `yaml:"numbering"`
-	Labels     map[string]string `yaml:"labels"`
+	MDoc        bool              `yaml:"mdoc"`
+	Theme       string            `yaml:"theme"`
+	Title       string            `yaml:"title"`
+	Author      string            `yaml:"author"`
+	Tags        []string          `yaml:"tags"`
+	Subtitle    string            `yaml:"subtitle"`
+	Date        string            `yaml:"date"`
+	Institution string            `yaml:"institution"`
+	Supervisor  string            `yaml:"supervisor"`
+	Logo        string            `yaml:"logo"`
+	Version     string            `yaml:"version"`
+	Abstract    string            `yaml:"abstract"`
+	Lang        string            `yaml:"lang"`
+	Page        Page              `yaml:"page"`
+	Data        map[string]any    `yaml:"data"`
+	References  []Reference       `yaml:"references"`
+	Numbering   Numbering         `yaml:"numbering"`
+	Labels      map[string]string `yaml:"labels"`
+	Typography  Typography        `yaml:"typography"`
+	Stats       Stats             `yaml:"stats"`
+	Footnotes   Footnotes         `yaml:"footnotes"`
 }
 
 // Reference is one bibliography entry. Cited from the body with `[@<key>]` and
@@ -84,18 +104,101 @@ type NumLevel struct {
 	Style    string `yaml:"style"`
 }
 
-// Page mirrors the relevant parts of CSS @page. Both fields are passed
+// Typography configures optional typesetting of the body text. Smart turns on
+// language-aware quotes, no-break spaces before units and after reference words
+// ("Abb. 2"), and en dashes in number ranges; it is off by default so the text
+// renders exactly as written.
+type Typography struct {
+	Smart bool `yaml:"smart"`
+}
+
+// StatsParts are the parts of a document the word count can leave out.
+var StatsParts = []string{"code", "math", "captions", "bibliography", "footnotes"}
+
+// Stats configures the word and character counts ({{.Stats}}, `mdoc stats`).
+// Exclude names the parts not counted (see StatsParts); unset, code and math
+// are left out, and an empty list counts everything.
+type Stats struct {
+	Exclude []string `yaml:"exclude"`
+}
+
+// Excluded returns the parts left out of the counts, applying the default.
+func (s Stats) Excluded() []string {
+	if s.Exclude == nil {
+		return []string{"code", "math"}
+	}
+	return s.Exclude
+}
+
+func (s Stats) validate() error {
+	for _, part := range s.Exclude {
+		if !slices.Contains(StatsParts, part) {
+			return fmt.Errorf("stats.exclude: unknown part %q (want one of %s)", part, strings.Join(StatsParts, ", "))
+		}
+	}
+	return nil
+}
+
+// Footnotes configures where `[^x]` footnotes go. Mode "endnotes" (the
+// default) collects them in one list at a `:::endnotes` directive, or at the
+// end of the body without one; "page" sets each note at the bottom of the page
+// that references it, which needs a theme that floats the notes there (the
+// built-in "system" theme does). Reset restarts the page-bottom numbering at
+// every "page" or "chapter" (level-1 heading); the default "document" numbers
+// straight through.
+type Footnotes struct {
+	Mode  string `yaml:"mode"`
+	Reset string `yaml:"reset"`
+}
+
+// Placement returns the footnote mode, applying the default.
+func (f Footnotes) Placement() string {
+	if f.Mode == "" {
+		return "endnotes"
+	}
+	return f.Mode
+}
+
+// Restart returns the numbering reset, applying the default.
+func (f Footnotes) Restart() string {
+	if f.Reset == "" {
+		return "document"
+	}
+	return f.Reset
+}
+
+func (f Footnotes) validate() error {
+	if m := f.Placement(); m != "page" && m != "endnotes" {
+		return fmt.Errorf("footnotes.mode: unknown mode %q (want page or endnotes)", m)
+	}
+	if r := f.Restart(); r != "document" && r != "chapter" && r != "page" {
+		return fmt.Errorf("footnotes.reset: unknown reset %q (want document, chapter or page)", r)
+	}
+	return nil
+}
+
+// Page mirrors the relevant parts of CSS @page. Size and Margin are passed
 // through verbatim into the theme's @page rule, so anything CSS accepts
 // (named sizes like "A4" / "Letter", explicit "210mm 297mm", "A4 landscape",
 // the four-value margin shorthand, etc.) is valid. Themes provide the
-// fallback when a field is empty.
+// fallback when a field is empty. Columns sets the whole body in that many
+// columns, as if it were wrapped in `:::columns`; 0 or 1 leaves it in one.
 type Page struct {
-	Size   string `yaml:"size"`
-	Margin string `yaml:"margin"`
+	Size    string `yaml:"size"`
+	Margin  string `yaml:"margin"`
+	Columns int    `yaml:"columns"`
+}
+
+func (p Page) validate() error {
+	if p.Columns < 0 {
+		return fmt.Errorf("page.columns: %d is negative", p.Columns)
+	}
+	return nil
 }
 
 // Default is applied when a file has no frontmatter or its frontmatter does not
-// opt in with `mdoc: true`.
+// opt in with `mdoc: true`. The user config's `defaults` section is still
+// layered on top of it (see Open).
 var Default = Config{
 	MDoc:   true,
 	Theme:  "", // empty -> built-in default theme ("system"); see internal/theme.Resolve
@@ -121,41 +224,169 @@ type Document struct {
 	// The watcher (live preview) and the bundler read it so a change to any
 	// chapter triggers a reload and every chapter lands in the .mdoc archive.
 	Includes []string
+	// Assets lists the absolute paths of the files outside Dir that Body's
+	// rebased `_/file/…` URLs name (see assets.go), plus those of partials the
+	// theme pulls in with `include` once rendered. They are the only files
+	// outside Dir the preview and print servers serve.
+	Assets []string
+	// Lines maps each line of Body, by index, to the file and line it came
+	// from, through include splicing. The preview uses it to jump from a
+	// rendered block to its source.
+	Lines []SourceLine
+	// Bases lists the absolute paths of the base configs the frontmatter
+	// inherits from via `extends`, nearest first.
+	Bases []string
+	// DataFiles lists the absolute paths of the files loaded into Config.Data
+	// (see data.go), sorted.
+	DataFiles []string
+	// Project is the mdoc.yaml found above Dir, or nil when the document isn't
+	// part of a project.
+	Project *config.Project
+}
+
+// Dependencies returns the absolute paths of every file besides the document
+// itself whose content feeds the render: included chapters, base configs, data
+// files, then the project config and its references file. The live-preview
+// watcher follows them so an edit to any of them reloads the preview.
+func (d *Document) Dependencies() []string {
+	deps := append(slices.Clone(d.Includes), d.Bases...)
+	deps = append(deps, d.DataFiles...)
+	if d.Project != nil {
+		deps = append(deps, d.Project.Path)
+		if refs := d.Project.ReferencesPath(); refs != "" {
+			deps = append(deps, refs)
+		}
+	}
+	return deps
 }
 
-// Open reads and parses a markdown file.
+// Open reads and parses a markdown file. The document's configuration is built
+// in layers, each overriding the one before: the `defaults` section of the user
+// config file (~/.config/mdoc/config.yaml), the `defaults` of the project's
+// mdoc.yaml (see internal/config), then the base configs the frontmatter
+// `extends` (see extends.go), then the document's own frontmatter. Maps
+// such as `labels` or `data` merge key by key; scalars and lists from a later
+// layer replace the earlier value outright. A file that doesn't opt in with
+// `mdoc: true` gets Default with the user and project defaults on top. A
+// project references file is prepended to the document's own references, and
+// `data` values naming data files are replaced by the files' content.
 func Open(path string) (*Document, error) {
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		return nil, fmt.Errorf("resolve path: %w", err)
 	}
 
-	f, err := os.Open(abs)
+	raw, err := os.ReadFile(abs)
 	if err != nil {
 		return nil, fmt.Errorf("open document: %w", err)
 	}
-	defer f.Close()
 
-	var cfg Config
-	body, err := frontmatter.Parse(f, &cfg)
+	dir := filepath.Dir(abs)
+	user, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	project, err := config.FindProject(dir)
+	if err != nil {
+		return nil, err
+	}
+	applyDefaults := func(cfg *Config) error {
+		if err := user.DecodeDefaults(cfg); err != nil {
+			return err
+		}
+		if project != nil {
+			return project.DecodeDefaults(cfg)
+		}
+		return nil
+	}
+
+	front, body, err := parseFrontmatter(bytes.NewReader(raw))
 	if err != nil {
 		return nil, fmt.Errorf("parse frontmatter: %w", err)
 	}
-	if !cfg.MDoc {
+	var cfg Config
+	var bases []string
+	// Only the document itself can opt in; a base's `mdoc` is irrelevant.
+	if optIn, _ := lookupKey(front, "mdoc"); optIn == true {
+		merged, extended, err := resolveExtends(front, dir, project, []string{abs})
+		if err != nil {
+			return nil, err
+		}
+		bases = extended
+		if err := applyDefaults(&cfg); err != nil {
+			return nil, err
+		}
+		mergedYAML, err := yaml.Marshal(merged)
+		if err == nil {
+			err = yaml.Unmarshal(mergedYAML, &cfg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse frontmatter: %w", err)
+		}
+		cfg.MDoc = true
+	} else {
 		cfg = Default
+		// Fresh containers so decoding the defaults can't write through into
+		// the shared Default value.
+		cfg.Tags = []string{}
+		cfg.Data = map[string]any{}
+		if err := applyDefaults(&cfg); err != nil {
+			return nil, err
+		}
+		cfg.MDoc = true
+	}
+	if err := cfg.Stats.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Footnotes.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Page.validate(); err != nil {
+		return nil, err
+	}
+	if project != nil && project.ReferencesPath() != "" {
+		refs, err := readReferences(project.ReferencesPath())
+		if err != nil {
+			return nil, err
+		}
+		cfg.References = append(refs, cfg.References...)
 	}
 
-	dir := filepath.Dir(abs)
-	combined, includes, err := resolveIncludes(string(body), dir, []string{abs})
+	dataFiles, err := loadDataFiles(cfg.Data, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	all := func(string) bool { return true }
+	combined, includes, lines, assets, err := spliceIncludes(string(body), bodyLine(raw, body), dir, dir, IncludeSearchDirs(project), []string{abs}, all)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Document{
-		Config:   cfg,
-		Body:     combined,
-		Path:     abs,
-		Dir:      dir,
-		Includes: includes,
+		Config:    cfg,
+		Body:      combined,
+		Path:      abs,
+		Dir:       dir,
+		Includes:  includes,
+		Assets:    assets,
+		Lines:     lines,
+		Bases:     bases,
+		DataFiles: dataFiles,
+		Project:   project,
 	}, nil
 }
+
+// readReferences loads a references file: a YAML (or JSON) list of entries in
+// the frontmatter `references` shape.
+func readReferences(path string) ([]Reference, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read references: %w", err)
+	}
+	var refs []Reference
+	if err := yaml.Unmarshal(raw, &refs); err != nil {
+		return nil, fmt.Errorf("parse references %s: %w", paths.Display(path), err)
+	}
+	return refs, nil
+}
@@ -0,0 +1,222 @@
+package document
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenMergesUserDefaults(t *testing.T) {
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	write(t, filepath.Join(cfg, "mdoc"), "config.yaml", `defaults:
+  author: Team
+  title: Default title
+  labels:
+    figure: Abbildung
+    table: Tabelle
+  numbering:
+    enabled: true
+`)
+
+	dir := t.TempDir()
+	path := write(t, dir, "doc.md", `---
+mdoc: true
+title: Own title
+labels:
+  table: Tab.
+---
+Body.`)
+
+	doc, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := doc.Config
+	if c.Title != "Own title" {
+		t.Errorf("Title = %q, frontmatter should win", c.Title)
+	}
+	if c.Author != "Team" {
+		t.Errorf("Author = %q, want the user default", c.Author)
+	}
+	if c.Labels["figure"] != "Abbildung" || c.Labels["table"] != "Tab." {
+		t.Errorf("Labels = %v, want maps merged with the frontmatter winning", c.Labels)
+	}
+	if !c.Numbering.Enabled {
+		t.Error("Numbering.Enabled should come from the user defaults")
+	}
+}
+
+func TestOpenDefaultsWithoutOptIn(t *testing.T) {
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	write(t, filepath.Join(cfg, "mdoc"), "config.yaml", "defaults:\n  author: Team\n")
+
+	dir := t.TempDir()
+	path := write(t, dir, "plain.md", "# Just markdown")
+	doc, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Config.Title != Default.Title || doc.Config.Author != "Team" {
+		t.Errorf("got title %q author %q, want built-in title with the user author", doc.Config.Title, doc.Config.Author)
+	}
+	if !doc.Config.MDoc {
+		t.Error("MDoc should be true for the default config")
+	}
+}
+
+func TestOpenProjectConfig(t *testing.T) {
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	write(t, filepath.Join(cfg, "mdoc"), "config.yaml", "defaults:\n  author: User\n  labels: {figure: Fig.}\n")
+
+	project := t.TempDir()
+	write(t, project, "mdoc.yaml", `defaults:
+  author: Project
+  theme: ./themes/company.html
+  labels: {table: Tabelle}
+references: refs.yaml
+`)
+	write(t, project, "refs.yaml", "- key: shared\n  title: Shared entry\n")
+	path := write(t, project, "specs/a.md", "---\nmdoc: true\nreferences:\n  - key: own\n---\nBody.")
+
+	doc, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := doc.Config
+	if c.Author != "Project" {
+		t.Errorf("Author = %q, project should override the user default", c.Author)
+	}
+	if c.Labels["figure"] != "Fig." || c.Labels["table"] != "Tabelle" {
+		t.Errorf("Labels = %v, want user and project labels merged", c.Labels)
+	}
+	if want := filepath.Join(project, "themes", "company.html"); c.Theme != want {
+		t.Errorf("Theme = %q, want the project-relative path anchored at %q", c.Theme, want)
+	}
+	if len(c.References) != 2 || c.References[0].Key != "shared" || c.References[1].Key != "own" {
+		t.Errorf("References = %+v, want the project file then the document's own", c.References)
+	}
+	deps := doc.Dependencies()
+	if len(deps) != 2 || deps[0] != filepath.Join(project, "mdoc.yaml") || deps[1] != filepath.Join(project, "refs.yaml") {
+		t.Errorf("Dependencies = %v, want mdoc.yaml and refs.yaml", deps)
+	}
+}
+
+func TestOpenLoadsDataFiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	write(t, dir, "data/items.csv", "\ufeffname, price\nWidget,9.50\n\"Bolt, large\",0.25\n")
+	write(t, dir, "meta.json", `{"invoice": "R-17", "lines": [{"qty": 2}]}`)
+	write(t, dir, "client.yaml", "name: ACME\naddress: {city: Berlin}\n")
+	path := write(t, dir, "doc.md", `---
+mdoc: true
+data:
+  items: ./data/items.csv
+  meta: {file: meta.json}
+  client: {file: ./client.yaml}
+  note: plain text
+  version: v1.2
+  report: report.csv
+  notes: ./notes.txt
+  spec: https://x.org/spec.json
+---
+`)
+
+	doc, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := doc.Config.Data
+	items, ok := data["items"].([]any)
+	if !ok || len(items) != 2 {
+		t.Fatalf("items = %#v, want two rows", data["items"])
+	}
+	if row := items[1].(map[string]any); row["name"] != "Bolt, large" || row["price"] != "0.25" {
+		t.Errorf("row = %v, want the quoted cell and a trimmed header", row)
+	}
+	if meta := data["meta"].(map[string]any); meta["invoice"] != "R-17" {
+		t.Errorf("meta = %v", meta)
+	}
+	client := data["client"].(map[string]any)
+	if addr, ok := client["address"].(map[string]any); !ok || addr["city"] != "Berlin" {
+		t.Errorf("client = %#v, want nested maps keyed by string", client)
+	}
+	for key, want := range map[string]string{"note": "plain text", "version": "v1.2", "report": "report.csv", "notes": "./notes.txt", "spec": "https://x.org/spec.json"} {
+		if data[key] != want {
+			t.Errorf("data.%s = %v; plain strings should be left alone", key, data[key])
+		}
+	}
+	want := []string{filepath.Join(dir, "client.yaml"), filepath.Join(dir, "data", "items.csv"), filepath.Join(dir, "meta.json")}
+	if len(doc.DataFiles) != 3 || doc.DataFiles[0] != want[0] || doc.DataFiles[1] != want[1] || doc.DataFiles[2] != want[2] {
+		t.Errorf("DataFiles = %v, want %v", doc.DataFiles, want)
+	}
+}
+
+func TestOpenMissingDataFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := write(t, t.TempDir(), "doc.md", "---\nmdoc: true\ndata: {items: {file: ./nope.csv}}\n---\n")
+	_, err := Open(path)
+	if err == nil || !strings.Contains(err.Error(), "data.items") {
+		t.Fatalf("expected an error naming data.items, got %v", err)
+	}
+}
+
+func TestOpenRejectsDuplicateCSVColumns(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	write(t, dir, "items.csv", "name,price,name\nWidget,9.50,Bolt\n")
+	path := write(t, dir, "doc.md", "---\nmdoc: true\ndata: {items: {file: items.csv}}\n---\n")
+	_, err := Open(path)
+	if err == nil || !strings.Contains(err.Error(), `duplicate column "name"`) {
+		t.Fatalf("expected an error naming the duplicate column, got %v", err)
+	}
+}
+
+func TestDataFileHomePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	write(t, home, "meta.json", `{"a": 1}`)
+	dir := t.TempDir()
+	write(t, dir, "~other/meta.json", `{"a": 2}`)
+	path := write(t, dir, "doc.md", "---\nmdoc: true\ndata: {home: ~/meta.json, rel: {file: ~other/meta.json}}\n---\n")
+	doc, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.Config.Data["home"].(map[string]any)["a"]; got != 1.0 {
+		t.Errorf("~/meta.json: a = %v, want 1 from the home directory", got)
+	}
+	if got := doc.Config.Data["rel"].(map[string]any)["a"]; got != 2.0 {
+		t.Errorf("~other/meta.json: a = %v, want 2 from the document directory", got)
+	}
+}
+
+func TestOpenRejectsUnknownStatsPart(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := write(t, t.TempDir(), "doc.md", "---\nmdoc: true\nstats: {exclude: [code, tables]}\n---\n")
+	_, err := Open(path)
+	if err == nil || !strings.Contains(err.Error(), `unknown part "tables"`) {
+		t.Fatalf("expected an error naming the unknown part, got %v", err)
+	}
+}
+
+func TestOpenRejectsUnknownFootnoteMode(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := write(t, t.TempDir(), "doc.md", "---\nmdoc: true\nfootnotes: {mode: margin}\n---\n")
+	_, err := Open(path)
+	if err == nil || !strings.Contains(err.Error(), "footnotes.mode") {
+		t.Fatalf("expected a footnotes.mode error, got %v", err)
+	}
+}
+
+func TestOpenRejectsNegativeColumns(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := write(t, t.TempDir(), "doc.md", "---\nmdoc: true\npage: {columns: -1}\n---\n")
+	_, err := Open(path)
+	if err == nil || !strings.Contains(err.Error(), "page.columns") {
+		t.Fatalf("expected a page.columns error, got %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package document
+
+// Frontmatter inheritance lets documents share configuration the way includes
+// let them share body text. A document (or a base) names one base config with
+// `extends:`:
+//
+//	extends: company::report     # key: company/report.yaml in a themes dir
+//	extends: ../base.yaml        # path: relative to the extending file
+//
+// A key resolves like a theme key (see theme.SearchDirs) but to a .yaml file,
+// so a theme library can ship a base config next to each theme. A base is a
+// plain YAML file in the frontmatter shape and may itself extend another base.
+//
+// The extending file is merged over its base: maps merge key by key, scalars
+// and lists replace the base value, the top-level `references` are
+// concatenated (base entries first), and a key suffixed with "+" appends to the
+// base list instead of replacing it (`tags+: [draft]`).
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/adrg/frontmatter"
+	"gopkg.in/yaml.v2"
+
+	"github.com/hinkolas/mdoc/internal/config"
+	"github.com/hinkolas/mdoc/internal/paths"
+	"github.com/hinkolas/mdoc/internal/theme"
+)
+
+// maxExtendsDepth bounds a chain of bases; cycles are caught separately and
+// exactly, as with includes.
+const maxExtendsDepth = 32
+
+// appendSuffix marks a key whose list value is appended to the inherited list.
+const appendSuffix = "+"
+
+// parseFrontmatter reads r's frontmatter (in any format the frontmatter package
+// knows) into an ordered YAML map and returns the body after it. A file without
+// frontmatter yields an empty map.
+func parseFrontmatter(r io.Reader) (yaml.MapSlice, []byte, error) {
+	var front any
+	body, err := frontmatter.Parse(r, &front)
+	if err != nil {
+		return nil, nil, err
+	}
+	if front == nil {
+		return nil, body, nil
+	}
+	// Round-trip through YAML so JSON and TOML frontmatter land in the same
+	// ordered shape as YAML.
+	raw, err := yaml.Marshal(front)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal(raw, &m); err != nil {
+		return nil, nil, err
+	}
+	return m, body, nil
+}
+
+// resolveExtends merges m over the chain of bases it extends and returns the
+// result (with the `extends` key removed) plus the absolute paths of every base
+// pulled in, nearest first. dir is the directory a relative `extends` path in m
+// resolves against and project the document's mdoc.yaml (or nil), whose themes
+// dir a key resolves in; stack is the chain of files currently being resolved,
+// starting with the document, used for cycle detection.
+func resolveExtends(m yaml.MapSlice, dir string, project *config.Project, stack []string) (yaml.MapSlice, []string, error) {
+	if len(stack) > maxExtendsDepth {
+		return nil, nil, fmt.Errorf("extends depth exceeds %d (cycle or runaway nesting near %s)", maxExtendsDepth, dir)
+	}
+	target, _ := lookupKey(m, "extends")
+	own := withoutKey(m, "extends")
+	if target == nil || target == "" {
+		merged, err := mergeConfig(nil, own) // still expands "key+" entries
+		return merged, nil, err
+	}
+	name, ok := target.(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: extends must be a single key or path, got %v", paths.Display(stack[len(stack)-1]), target)
+	}
+
+	abs, err := resolveExtendsPath(name, dir, project)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", paths.Display(stack[len(stack)-1]), err)
+	}
+	if slices.Contains(stack, abs) {
+		return nil, nil, fmt.Errorf("extends cycle: %s extends itself (via %s)", paths.Display(stack[0]), paths.Display(abs))
+	}
+	base, err := readBase(abs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("extends %q (from %s): %w", name, paths.Display(stack[len(stack)-1]), err)
+	}
+	base, bases, err := resolveExtends(base, filepath.Dir(abs), project, append(stack, abs))
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, err := mergeConfig(base, own)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, append([]string{abs}, bases...), nil
+}
+
+// resolveExtendsPath turns an `extends` value into the absolute path of the
+// base file, using the key/scope/path rule of paths.Classify. A key resolves to
+// <dir>/<key>.yaml in the first theme search dir of project that has it; a path
+// resolves from baseDir.
+func resolveExtendsPath(target, baseDir string, project *config.Project) (string, error) {
+	var rel string
+	switch paths.Classify(target) {
+	case paths.KindScopedKey:
+		r, err := paths.ScopedKeyToRelpath(target)
+		if err != nil {
+			return "", fmt.Errorf("resolve extends %q: %w", target, err)
+		}
+		rel = r
+	case paths.KindFlatKey:
+		rel = target
+	default: // KindPath
+		abs := target
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(baseDir, abs)
+		}
+		return filepath.Abs(abs)
+	}
+	dirs := theme.SearchDirs(project)
+	var tried []string
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(filepath.Join(dir, rel+".yaml"))
+		if err != nil {
+			return "", fmt.Errorf("resolve extends %q: %w", target, err)
+		}
+		if _, err := os.Stat(abs); err == nil {
+			return abs, nil
+		}
+		tried = append(tried, paths.Display(abs))
+	}
+	return "", fmt.Errorf("base config %q not found (looked for %s)", target, strings.Join(tried, " or "))
+}
+
+// readBase loads a base config file. A relative `theme` path in it is anchored
+// at the base's own directory, so a base can name a theme file sitting next to
+// it whichever document extends it.
+func readBase(path string) (yaml.MapSlice, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", paths.Display(path), err)
+	}
+	config.AnchorTheme(m, filepath.Dir(path))
+	return m, nil
+}
+
+// mergeConfig returns over merged onto base without modifying either: maps
+// merge recursively, the top-level `references` lists concatenate, a "key+"
+// list appends to the base's "key", and any other value in over replaces the
+// base's. Keys keep base order, with keys new in over following in their own
+// order.
+func mergeConfig(base, over yaml.MapSlice) (yaml.MapSlice, error) {
+	return mergeMaps(base, over, true)
+}
+
+// mergeMaps is mergeConfig for a map at any depth; top is true for the
+// frontmatter itself, the only level where `references` means the
+// bibliography (a `data.references` list replaces like any other).
+func mergeMaps(base, over yaml.MapSlice, top bool) (yaml.MapSlice, error) {
+	out := slices.Clone(base)
+	for _, item := range over {
+		key := fmt.Sprint(item.Key)
+		value := item.Value
+		name, appending := strings.CutSuffix(key, appendSuffix)
+		i := slices.IndexFunc(out, func(it yaml.MapItem) bool { return fmt.Sprint(it.Key) == name })
+		var prev any
+		if i >= 0 {
+			prev = out[i].Value
+		}
+
+		switch {
+		case appending || (top && name == "references"):
+			list, ok := value.([]any)
+			if !ok && value != nil {
+				return nil, fmt.Errorf("%s: expected a list to append", key)
+			}
+			prevList, ok := prev.([]any)
+			if !ok && prev != nil && appending {
+				return nil, fmt.Errorf("%s: inherited %s is not a list", key, name)
+			}
+			value = append(slices.Clone(prevList), list...)
+		default:
+			sub, isMap := value.(yaml.MapSlice)
+			if !isMap {
+				break
+			}
+			prevMap, _ := prev.(yaml.MapSlice) // nil when absent or not a map: sub replaces it
+			merged, err := mergeMaps(prevMap, sub, false)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%w", name, err)
+			}
+			value = merged
+		}
+
+		if i >= 0 {
+			out[i].Value = value
+		} else {
+			out = append(out, yaml.MapItem{Key: name, Value: value})
+		}
+	}
+	return out, nil
+}
+
+// InlineConfig returns src — the full text of doc's file — with the
+// configuration that lives outside it written into its YAML frontmatter: the
+// `extends` bases, and the `defaults` of doc's mdoc.yaml project with the
+// entries of its references file ahead of the document's own `references`. The
+// result renders the same without those files; the bundler uses it to keep a
+// .mdoc archive self-contained. A non-empty theme replaces the merged `theme`:
+// a base's or the project's relative theme path is anchored at its directory on
+// the author's machine, so the bundler passes where it stored the theme
+// instead. A document that neither extends a base nor sits in a project, or
+// that has no `---` YAML frontmatter opting in with `mdoc: true`, comes back
+// unchanged; a rewritten frontmatter loses its comments.
+func InlineConfig(src string, doc *Document, theme string) (string, error) {
+	front, body, ok := splitYAMLFrontmatter(src)
+	if !ok {
+		return src, nil
+	}
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(front), &m); err != nil {
+		return "", fmt.Errorf("parse frontmatter: %w", err)
+	}
+	if optIn, _ := lookupKey(m, "mdoc"); optIn != true {
+		return src, nil
+	}
+	if _, extends := lookupKey(m, "extends"); !extends && doc.Project == nil {
+		return src, nil
+	}
+	merged, _, err := resolveExtends(m, doc.Dir, doc.Project, []string{doc.Path})
+	if err != nil {
+		return "", err
+	}
+	if doc.Project != nil {
+		layer, err := projectLayer(doc.Project)
+		if err != nil {
+			return "", err
+		}
+		if merged, err = mergeConfig(layer, merged); err != nil {
+			return "", err
+		}
+	}
+	if theme != "" {
+		merged = withKey(merged, "theme", theme)
+	}
+	raw, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return "---\n" + string(raw) + "---\n" + body, nil
+}
+
+// projectLayer returns what project contributes to a document's configuration,
+// in frontmatter shape: its `defaults`, with the entries of its references file
+// as `references` (see Open).
+func projectLayer(project *config.Project) (yaml.MapSlice, error) {
+	layer := slices.Clone(project.Defaults)
+	path := project.ReferencesPath()
+	if path == "" {
+		return layer, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read references: %w", err)
+	}
+	var refs []any
+	if err := yaml.Unmarshal(raw, &refs); err != nil {
+		return nil, fmt.Errorf("parse references %s: %w", paths.Display(path), err)
+	}
+	own, _ := lookupKey(layer, "references")
+	ownList, _ := own.([]any)
+	return withKey(layer, "references", append(refs, ownList...)), nil
+}
+
+// splitYAMLFrontmatter splits src into the text between a leading `---` line
+// and the next `---` line, and everything after that closing line.
+func splitYAMLFrontmatter(src string) (front, body string, ok bool) {
+	first, rest, found := strings.Cut(src, "\n")
+	if !found || strings.TrimRight(first, " \t\r") != "---" {
+		return "", "", false
+	}
+	for off := 0; off < len(rest); {
+		line, after, _ := strings.Cut(rest[off:], "\n")
+		if strings.TrimRight(line, " \t\r") == "---" {
+			return rest[:off], after, true
+		}
+		off += len(line) + 1
+	}
+	return "", "", false
+}
+
+func lookupKey(m yaml.MapSlice, key string) (any, bool) {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func withoutKey(m yaml.MapSlice, key string) yaml.MapSlice {
+	return slices.DeleteFunc(slices.Clone(m), func(it yaml.MapItem) bool { return fmt.Sprint(it.Key) == key })
+}
+
+// withKey returns m with key set to value, in place of an existing entry or
+// appended.
+func withKey(m yaml.MapSlice, key string, value any) yaml.MapSlice {
+	out := slices.Clone(m)
+	if i := slices.IndexFunc(out, func(it yaml.MapItem) bool { return fmt.Sprint(it.Key) == key }); i >= 0 {
+		out[i].Value = value
+		return out
+	}
+	return append(out, yaml.MapItem{Key: key, Value: value})
+}
@@ -0,0 +1,198 @@
+package document
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestOpenExtendsChain(t *testing.T) {
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	// A key base in the user themes dir, extended by a path base next to the
+	// document.
+	write(t, filepath.Join(cfg, "mdoc", "themes"), "company/report.yaml", `theme: ./report.html
+author: Company
+tags: [company]
+labels: {figure: Abbildung, table: Tabelle}
+references:
+  - key: handbook
+`)
+	dir := t.TempDir()
+	write(t, dir, "base.yaml", `extends: company::report
+tags+: [internal]
+labels: {table: Tab.}
+references:
+  - key: style
+`)
+	path := write(t, dir, "doc.md", `---
+mdoc: true
+extends: ./base.yaml
+title: Q3
+tags+: [draft]
+references:
+  - key: own
+---
+Body.`)
+
+	doc, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := doc.Config
+	if c.Title != "Q3" || c.Author != "Company" {
+		t.Errorf("Title, Author = %q, %q; want the document's title and the base's author", c.Title, c.Author)
+	}
+	if got := strings.Join(c.Tags, ","); got != "company,internal,draft" {
+		t.Errorf("Tags = %s, want company,internal,draft", got)
+	}
+	if c.Labels["figure"] != "Abbildung" || c.Labels["table"] != "Tab." {
+		t.Errorf("Labels = %v, want maps merged with the nearer value winning", c.Labels)
+	}
+	var keys []string
+	for _, r := range c.References {
+		keys = append(keys, r.CiteKey())
+	}
+	if got := strings.Join(keys, ","); got != "handbook,style,own" {
+		t.Errorf("References = %s, want handbook,style,own", got)
+	}
+	if want := filepath.Join(cfg, "mdoc", "themes", "company", "report.html"); c.Theme != want {
+		t.Errorf("Theme = %q, want the base-relative path anchored at %q", c.Theme, want)
+	}
+	want := []string{filepath.Join(dir, "base.yaml"), filepath.Join(cfg, "mdoc", "themes", "company", "report.yaml")}
+	if len(doc.Bases) != 2 || doc.Bases[0] != want[0] || doc.Bases[1] != want[1] {
+		t.Errorf("Bases = %v, want %v", doc.Bases, want)
+	}
+}
+
+func TestOpenExtendsCycle(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	write(t, dir, "a.yaml", "extends: ./b.yaml\n")
+	write(t, dir, "b.yaml", "extends: ./a.yaml\n")
+	path := write(t, dir, "doc.md", "---\nmdoc: true\nextends: ./a.yaml\n---\n")
+
+	_, err := Open(path)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected an extends cycle error, got %v", err)
+	}
+}
+
+func TestOpenExtendsMissingKey(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := write(t, t.TempDir(), "doc.md", "---\nmdoc: true\nextends: nope\n---\n")
+
+	_, err := Open(path)
+	if err == nil || !strings.Contains(err.Error(), `"nope" not found`) {
+		t.Fatalf("expected a not-found error naming the key, got %v", err)
+	}
+}
+
+func TestMergeConfigAppendRequiresList(t *testing.T) {
+	base := mustMap(t, "tags: [a]\ndata: {title: x}\n")
+	if _, err := mergeConfig(base, mustMap(t, "tags+: b\n")); err == nil {
+		t.Error("expected an error for a scalar append")
+	}
+	if _, err := mergeConfig(base, mustMap(t, "data+: [b]\n")); err == nil {
+		t.Error("expected an error appending to a map")
+	}
+}
+
+func TestMergeConfigConcatenatesTopLevelReferencesOnly(t *testing.T) {
+	base := mustMap(t, "references: [{key: a}]\ndata: {references: [old]}\n")
+	got, err := mergeConfig(base, mustMap(t, "references: [{key: b}]\ndata: {references: [new]}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, _ := lookupKey(got, "references")
+	if list, _ := refs.([]any); len(list) != 2 {
+		t.Errorf("references = %v, want base and own entries", refs)
+	}
+	data, _ := lookupKey(got, "data")
+	nested, _ := lookupKey(data.(yaml.MapSlice), "references")
+	if list, _ := nested.([]any); len(list) != 1 || list[0] != "new" {
+		t.Errorf("data.references = %v, want [new] replacing the base list", nested)
+	}
+}
+
+func TestInlineConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	write(t, dir, "base.yaml", "author: Base\ntags: [a]\n")
+	src := "---\nmdoc: true\nextends: ./base.yaml\ntags+: [b]\n---\n# Body\n"
+
+	got, err := InlineConfig(src, &Document{Path: filepath.Join(dir, "doc.md"), Dir: dir}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front, body, ok := splitYAMLFrontmatter(got)
+	if !ok {
+		t.Fatalf("no frontmatter in:\n%s", got)
+	}
+	for _, sub := range []string{"author: Base", "mdoc: true", "- a\n- b"} {
+		if !strings.Contains(front, sub) {
+			t.Errorf("missing %q in frontmatter:\n%s", sub, front)
+		}
+	}
+	if strings.Contains(front, "extends") || strings.Contains(front, "tags+") {
+		t.Errorf("extends not resolved:\n%s", front)
+	}
+	if body != "# Body\n" {
+		t.Errorf("body = %q, want it unchanged", body)
+	}
+
+	plain := "---\nmdoc: true\n---\nBody"
+	if got, err := InlineConfig(plain, &Document{Path: filepath.Join(dir, "doc.md"), Dir: dir}, "./themes/x.html"); err != nil || got != plain {
+		t.Errorf("a document without extends or project should come back unchanged, got %q, %v", got, err)
+	}
+}
+
+func TestInlineConfigRewritesTheme(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	write(t, dir, "shared/base.yaml", "theme: ./report.html\n")
+	src := "---\nmdoc: true\nextends: ./shared/base.yaml\n---\nBody\n"
+
+	got, err := InlineConfig(src, &Document{Path: filepath.Join(dir, "doc.md"), Dir: dir}, "./themes/report.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front, _, _ := splitYAMLFrontmatter(got)
+	if !strings.Contains(front, "theme: ./themes/report.html") || strings.Contains(front, dir) {
+		t.Errorf("theme not rewritten to the bundled entry:\n%s", front)
+	}
+}
+
+func TestInlineConfigProjectLayer(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	write(t, dir, "mdoc.yaml", "defaults:\n  author: Team\n  lang: de\nreferences: refs.yaml\n")
+	write(t, dir, "refs.yaml", "- key: shared\n")
+	path := write(t, dir, "specs/doc.md", "---\nmdoc: true\nlang: en\nreferences:\n  - key: own\n---\nBody\n")
+	doc, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := InlineConfig("---\nmdoc: true\nlang: en\nreferences:\n  - key: own\n---\nBody\n", doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front, _, _ := splitYAMLFrontmatter(got)
+	for _, sub := range []string{"author: Team", "lang: en", "- key: shared\n- key: own"} {
+		if !strings.Contains(front, sub) {
+			t.Errorf("missing %q in frontmatter:\n%s", sub, front)
+		}
+	}
+}
+
+func mustMap(t *testing.T, src string) yaml.MapSlice {
+	t.Helper()
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(src), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
@@ -16,12 +16,14 @@ package document
 //
 // Included files may carry their own YAML frontmatter so they stay individually
 // openable with `mdoc open chapter.md`; on include that frontmatter is parsed
-// off and discarded — all configuration comes from the root document. Relative
-// asset paths inside an included file resolve relative to the ROOT document's
-// directory (the combined body is rendered as if it all lived there), so shared
-// images belong under the root's tree.
+// off and discarded — all configuration comes from the root document. The
+// combined body is rendered as if it all lived in the root document's
+// directory, so relative image and link URLs inside an included file are
+// rebased onto it as the file is spliced (see assets.go): a chapter folder can
+// keep its own img/ directory.
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -29,6 +31,7 @@ import (
 	"strings"
 
 	"github.com/adrg/frontmatter"
+	"github.com/hinkolas/mdoc/internal/config"
 	"github.com/hinkolas/mdoc/internal/paths"
 )
 
@@ -36,14 +39,22 @@ import (
 // blow the stack; cycles are caught separately and exactly.
 const maxIncludeDepth = 64
 
+// SourceLine is where one line of a Document's Body came from: a file (the
+// document or an included chapter) and a 1-based line number in it.
+type SourceLine struct {
+	File string
+	Line int
+}
+
 // resolveIncludes returns body with every `:::include <path>` line replaced by
 // the (recursively resolved) body of the referenced file, plus the absolute
 // paths of all files pulled in, in include order. baseDir is the directory
 // include paths in this body resolve against (the directory of the file the
-// body came from). stack is the chain of absolute paths currently being
+// body came from); dirs are the search dirs a key include resolves in (see
+// IncludeSearchDirs). stack is the chain of absolute paths currently being
 // resolved, starting with the root document, used for cycle detection.
-func resolveIncludes(body, baseDir string, stack []string) (string, []string, error) {
-	return resolveIncludesFiltered(body, baseDir, stack, func(string) bool { return true })
+func resolveIncludes(body, baseDir string, dirs, stack []string) (string, []string, error) {
+	return resolveIncludesFiltered(body, baseDir, dirs, stack, func(string) bool { return true })
 }
 
 // resolveIncludesFiltered is resolveIncludes with a splice predicate: only
@@ -52,19 +63,38 @@ func resolveIncludes(body, baseDir string, stack []string) (string, []string, er
 // the included subtree is spliced unconditionally, so the predicate only gates
 // the current level. The bundler uses this to inline global includes (which have
 // no place in a portable archive) while leaving local path includes as files.
-func resolveIncludesFiltered(body, baseDir string, stack []string, splice func(target string) bool) (string, []string, error) {
+func resolveIncludesFiltered(body, baseDir string, dirs, stack []string, splice func(target string) bool) (string, []string, error) {
+	combined, included, _, _, err := spliceIncludes(body, 1, "", baseDir, dirs, stack, splice)
+	return combined, included, err
+}
+
+// spliceIncludes is resolveIncludesFiltered that also maps every line of the
+// result to its source (see SourceLine) and, unless rootDir is "", rebases the
+// relative URLs of every file in a directory other than rootDir onto it (see
+// rebaseURLs), also returning the files outside rootDir the rebased URLs name
+// (see Document.Assets). first is the line number body starts at in its file,
+// stack[len(stack)-1], past any frontmatter.
+func spliceIncludes(body string, first int, rootDir, baseDir string, dirs, stack []string, splice func(target string) bool) (string, []string, []SourceLine, []string, error) {
 	if len(stack) > maxIncludeDepth {
-		return "", nil, fmt.Errorf("include depth exceeds %d (cycle or runaway nesting near %s)", maxIncludeDepth, baseDir)
+		return "", nil, nil, nil, fmt.Errorf("include depth exceeds %d (cycle or runaway nesting near %s)", maxIncludeDepth, baseDir)
 	}
 
+	file := stack[len(stack)-1]
 	lines := strings.Split(body, "\n")
 	out := make([]string, 0, len(lines))
-	var included []string
+	src := make([]SourceLine, 0, len(lines))
+	var included, assets []string
 
 	var fenceChar byte // 0 when not inside a fenced code block
 	var fenceLen int
 
-	for _, raw := range lines {
+	base := ""
+	if rootDir != "" {
+		base = assetBase(rootDir, baseDir)
+	}
+
+	for i, raw := range lines {
+		here := SourceLine{File: file, Line: first + i}
 		line := strings.TrimSuffix(raw, "\r")
 		trimmed := strings.TrimLeft(line, " ")
 		indent := len(line) - len(trimmed)
@@ -75,43 +105,48 @@ func resolveIncludesFiltered(body, baseDir string, stack []string, splice func(t
 			if indent <= 3 && closesFence(trimmed, fenceChar, fenceLen) {
 				fenceChar = 0
 			}
-			out = append(out, line)
+			out, src = append(out, line), append(src, here)
 			continue
 		}
 		if indent <= 3 {
 			if c, n := opensFence(trimmed); n > 0 {
 				fenceChar, fenceLen = c, n
-				out = append(out, line)
+				out, src = append(out, line), append(src, here)
 				continue
 			}
 		}
 
 		path, ok := includeTarget(trimmed, indent)
 		if !ok {
-			out = append(out, line)
+			if base != "" {
+				var external []string
+				line, external = rebaseURLs(line, base)
+				assets = append(assets, external...)
+			}
+			out, src = append(out, line), append(src, here)
 			continue
 		}
 		if !splice(path) {
-			out = append(out, line) // keep the directive; this level skips it
+			out, src = append(out, line), append(src, here) // keep the directive; this level skips it
 			continue
 		}
 
-		abs, err := resolveIncludePath(path, baseDir)
+		abs, err := resolveIncludePath(path, baseDir, dirs)
 		if err != nil {
-			return "", nil, err
+			return "", nil, nil, nil, err
 		}
 
 		if slices.Contains(stack, abs) {
-			return "", nil, fmt.Errorf("include cycle: %s includes itself (via %s)", stack[0], abs)
+			return "", nil, nil, nil, fmt.Errorf("include cycle: %s includes itself (via %s)", stack[0], abs)
 		}
 
-		childBody, err := readIncludedBody(abs)
+		childBody, childFirst, err := readIncludedBody(abs)
 		if err != nil {
-			return "", nil, fmt.Errorf("include %q (from %s): %w", path, stack[len(stack)-1], err)
+			return "", nil, nil, nil, fmt.Errorf("include %q (from %s): %w", path, stack[len(stack)-1], err)
 		}
-		childCombined, childIncluded, err := resolveIncludes(childBody, filepath.Dir(abs), append(stack, abs))
+		childCombined, childIncluded, childSrc, childAssets, err := spliceIncludes(childBody, childFirst, rootDir, filepath.Dir(abs), dirs, append(stack, abs), func(string) bool { return true })
 		if err != nil {
-			return "", nil, err
+			return "", nil, nil, nil, err
 		}
 
 		// Surround the spliced content with blank lines so adjacent markdown
@@ -120,12 +155,16 @@ func resolveIncludesFiltered(body, baseDir string, stack []string, splice func(t
 		out = append(out, "")
 		out = append(out, strings.Split(childCombined, "\n")...)
 		out = append(out, "")
+		src = append(src, here)
+		src = append(src, childSrc...)
+		src = append(src, here)
 
 		included = append(included, abs)
 		included = append(included, childIncluded...)
+		assets = append(assets, childAssets...)
 	}
 
-	return strings.Join(out, "\n"), included, nil
+	return strings.Join(out, "\n"), included, src, assets, nil
 }
 
 // includeTarget reports whether a code-fence-cleared, leading-space-trimmed line
@@ -159,21 +198,22 @@ func includeTarget(trimmed string, indent int) (string, bool) {
 // resolveIncludePath turns a `:::include` target into the absolute path of the
 // file to splice, using the same key/scope/path rule as theme resolution
 // (paths.Classify). A bare flat key ("disclaimer") or a scoped key
-// ("legal::contract") resolves from the user includes dir
-// (~/.config/mdoc/includes); an explicit path ("./parts/intro.md",
+// ("legal::contract") resolves from dirs, the include search dirs (see
+// IncludeSearchDirs): the project's, then the user includes dir
+// (~/.config/mdoc/includes). An explicit path ("./parts/intro.md",
 // "chapters/01.md") resolves relative to baseDir — the directory of the file the
 // directive appears in, so a relative include inside a global partial resolves
 // against that partial's own directory.
-func resolveIncludePath(target, baseDir string) (string, error) {
+func resolveIncludePath(target, baseDir string, dirs []string) (string, error) {
 	switch paths.Classify(target) {
 	case paths.KindScopedKey:
 		rel, err := paths.ScopedKeyToRelpath(target)
 		if err != nil {
 			return "", fmt.Errorf("resolve include %q: %w", target, err)
 		}
-		return globalIncludePath(target, rel)
+		return keyIncludePath(target, rel, dirs)
 	case paths.KindFlatKey:
-		return globalIncludePath(target, target)
+		return keyIncludePath(target, target, dirs)
 	default: // KindPath
 		abs := target
 		if !filepath.IsAbs(abs) {
@@ -187,8 +227,48 @@ func resolveIncludePath(target, baseDir string) (string, error) {
 	}
 }
 
-// isGlobalInclude reports whether a `:::include` target resolves from the user
-// includes dir (a bare or scoped key) rather than a filesystem path.
+// IncludeSearchDirs returns the directories a bare or scoped `:::include` key
+// is looked up in for a document in project (nil outside one), in order: the
+// project's includes/ directory and configured `includes` dirs, then the user
+// includes dir.
+func IncludeSearchDirs(project *config.Project) []string {
+	var dirs []string
+	if project != nil {
+		dirs = append(dirs, project.IncludeDirs()...)
+	}
+	if user, err := paths.IncludesDir(); err == nil {
+		dirs = append(dirs, user)
+	}
+	return dirs
+}
+
+// ReadInclude resolves target exactly like an `:::include` directive of d in a
+// file in baseDir and returns the resolved path plus the file's body,
+// frontmatter stripped, its own includes spliced and its relative URLs rebased
+// onto d.Dir, which the rendered HTML is served from whatever baseDir is. The
+// files outside d.Dir those URLs name are added to d.Assets. The template
+// `include` function uses it (see internal/render).
+func (d *Document) ReadInclude(target, baseDir string) (string, string, error) {
+	dirs := IncludeSearchDirs(d.Project)
+	abs, err := resolveIncludePath(target, baseDir, dirs)
+	if err != nil {
+		return "", "", err
+	}
+	body, first, err := readIncludedBody(abs)
+	if err != nil {
+		return "", "", fmt.Errorf("include %q: %w", target, err)
+	}
+	all := func(string) bool { return true }
+	combined, _, _, assets, err := spliceIncludes(body, first, d.Dir, filepath.Dir(abs), dirs, []string{abs}, all)
+	if err != nil {
+		return "", "", err
+	}
+	d.Assets = append(d.Assets, assets...)
+	return abs, combined, nil
+}
+
+// isGlobalInclude reports whether a `:::include` target is a bare or scoped key,
+// resolved from the include search dirs rather than as a filesystem path.
 func isGlobalInclude(target string) bool {
 	return paths.Classify(target) != paths.KindPath
 }
@@ -198,9 +278,10 @@ func isGlobalInclude(target string) bool {
 // scoped key such as `disclaimer` or `legal::contract` — recursively spliced
 // inline, while local path includes (`./parts/intro.md`) are left as directives.
 // The bundler uses it so global partials, which live outside the document tree
-// and have no home in a portable archive, travel inside the bundled files. A
+// and have no home in a portable archive, travel inside the bundled files. Keys
+// resolve in the include search dirs of project (see IncludeSearchDirs). A
 // document with no global includes comes back unchanged.
-func FlattenGlobalIncludes(path string) (string, error) {
+func FlattenGlobalIncludes(path string, project *config.Project) (string, error) {
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		return "", err
@@ -209,39 +290,53 @@ func FlattenGlobalIncludes(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	combined, _, err := resolveIncludesFiltered(string(raw), filepath.Dir(abs), []string{abs}, isGlobalInclude)
+	combined, _, err := resolveIncludesFiltered(string(raw), filepath.Dir(abs), IncludeSearchDirs(project), []string{abs}, isGlobalInclude)
 	return combined, err
 }
 
-// globalIncludePath joins a relative path under the user includes dir and makes
-// it absolute. target is the original directive value, kept for diagnostics.
-func globalIncludePath(target, rel string) (string, error) {
-	dir, err := paths.IncludesDir()
-	if err != nil {
-		return "", fmt.Errorf("resolve include %q: %w", target, err)
+// keyIncludePath finds a key include: the first <dir>/<rel>.md that exists
+// across dirs, the include search dirs. When none does it returns the candidate
+// in the user includes dir, so the read fails with a "no such file" error
+// naming the canonical location. target is the original directive value, kept
+// for diagnostics.
+func keyIncludePath(target, rel string, dirs []string) (string, error) {
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("resolve include %q: no includes directory available", target)
 	}
-	abs, err := filepath.Abs(filepath.Join(dir, rel+".md"))
-	if err != nil {
-		return "", fmt.Errorf("resolve include %q: %w", target, err)
+	var candidate string
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(filepath.Join(dir, rel+".md"))
+		if err != nil {
+			return "", fmt.Errorf("resolve include %q: %w", target, err)
+		}
+		if _, err := os.Stat(abs); err == nil {
+			return abs, nil
+		}
+		candidate = abs
 	}
-	return abs, nil
+	return candidate, nil
 }
 
 // readIncludedBody reads an included file and strips any YAML frontmatter,
-// returning just the markdown body. The frontmatter is discarded: configuration
-// always comes from the root document.
-func readIncludedBody(path string) (string, error) {
-	f, err := os.Open(path)
+// returning just the markdown body and the file line it starts at. The
+// frontmatter is discarded: configuration always comes from the root document.
+func readIncludedBody(path string) (string, int, error) {
+	raw, err := os.ReadFile(path)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
-	defer f.Close()
 	var ignored struct{} // discard the included file's frontmatter
-	body, err := frontmatter.Parse(f, &ignored)
+	body, err := frontmatter.Parse(bytes.NewReader(raw), &ignored)
 	if err != nil {
-		return "", fmt.Errorf("parse frontmatter: %w", err)
+		return "", 0, fmt.Errorf("parse frontmatter: %w", err)
 	}
-	return string(body), nil
+	return string(body), bodyLine(raw, body), nil
+}
+
+// bodyLine returns the line of raw, a whole file, that body (what follows its
+// frontmatter) starts at.
+func bodyLine(raw, body []byte) int {
+	return bytes.Count(raw, []byte("\n")) - bytes.Count(body, []byte("\n")) + 1
 }
 
 // opensFence reports the fence character and run length if trimmed opens a
@@ -3,8 +3,11 @@ package document
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/hinkolas/mdoc/internal/config"
 )
 
 // write creates a file under dir (creating parent dirs) and returns its path.
@@ -25,7 +28,7 @@ func TestResolveIncludesBasic(t *testing.T) {
 	write(t, dir, "chapter1.md", "# Chapter One\n\nFirst chapter.")
 	root := "Intro.\n\n:::include chapter1.md\n\nOutro."
 
-	got, included, err := resolveIncludes(root, dir, []string{filepath.Join(dir, "root.md")})
+	got, included, err := resolveIncludes(root, dir, IncludeSearchDirs(nil), []string{filepath.Join(dir, "root.md")})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -51,7 +54,7 @@ func TestResolveIncludesGlobalKey(t *testing.T) {
 
 	dir := t.TempDir()
 	root := ":::include disclaimer\n\n:::include legal::contract"
-	got, included, err := resolveIncludes(root, dir, []string{filepath.Join(dir, "root.md")})
+	got, included, err := resolveIncludes(root, dir, IncludeSearchDirs(nil), []string{filepath.Join(dir, "root.md")})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -66,6 +69,41 @@ func TestResolveIncludesGlobalKey(t *testing.T) {
 	}
 }
 
+func TestResolveIncludesProjectKey(t *testing.T) {
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	write(t, filepath.Join(cfg, "mdoc", "includes"), "disclaimer.md", "user disclaimer")
+	write(t, filepath.Join(cfg, "mdoc", "includes"), "closing.md", "user closing")
+
+	project := t.TempDir()
+	write(t, project, "mdoc.yaml", "includes: [shared]\n")
+	write(t, project, "includes/disclaimer.md", "project disclaimer")
+	write(t, project, "shared/legal/clause.md", "shared clause")
+	dir := filepath.Join(project, "specs")
+
+	p, err := config.FindProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := ":::include disclaimer\n\n:::include legal::clause\n\n:::include closing"
+	got, _, err := resolveIncludes(root, dir, IncludeSearchDirs(p), []string{filepath.Join(dir, "root.md")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Project includes/ beats the user dir; the configured search path is
+	// consulted next; the user dir is the last resort.
+	wantAll := []string{"project disclaimer", "shared clause", "user closing"}
+	for _, sub := range wantAll {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in:\n%s", sub, got)
+		}
+	}
+	if strings.Contains(got, "user disclaimer") {
+		t.Errorf("project include should shadow the user one:\n%s", got)
+	}
+}
+
 func TestFlattenGlobalIncludes(t *testing.T) {
 	cfg := t.TempDir()
 	t.Setenv("XDG_CONFIG_HOME", cfg)
@@ -76,7 +114,7 @@ func TestFlattenGlobalIncludes(t *testing.T) {
 	write(t, dir, "local.md", "## Local chapter")
 	rootPath := write(t, dir, "root.md", "# Doc\n\n:::include boilerplate\n\n:::include local.md")
 
-	got, err := FlattenGlobalIncludes(rootPath)
+	got, err := FlattenGlobalIncludes(rootPath, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -99,7 +137,7 @@ func TestResolveIncludesNested(t *testing.T) {
 	write(t, dir, "part1/chapter.md", "## Deep chapter")
 	root := ":::include part1/index.md"
 
-	got, included, err := resolveIncludes(root, dir, []string{filepath.Join(dir, "root.md")})
+	got, included, err := resolveIncludes(root, dir, IncludeSearchDirs(nil), []string{filepath.Join(dir, "root.md")})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -117,7 +155,7 @@ func TestResolveIncludesStripsFrontmatter(t *testing.T) {
 	write(t, dir, "chapter.md", "---\nmdoc: true\ntitle: Standalone\ntheme: other\n---\n# Body Heading\n\nText.")
 	root := ":::include chapter.md"
 
-	got, _, err := resolveIncludes(root, dir, []string{filepath.Join(dir, "root.md")})
+	got, _, err := resolveIncludes(root, dir, IncludeSearchDirs(nil), []string{filepath.Join(dir, "root.md")})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -134,7 +172,7 @@ func TestResolveIncludesStripsFrontmatter(t *testing.T) {
 func TestResolveIncludesMissingFile(t *testing.T) {
 	dir := t.TempDir()
 	root := ":::include nope.md"
-	_, _, err := resolveIncludes(root, dir, []string{filepath.Join(dir, "root.md")})
+	_, _, err := resolveIncludes(root, dir, IncludeSearchDirs(nil), []string{filepath.Join(dir, "root.md")})
 	if err == nil {
 		t.Fatal("expected an error for a missing include")
 	}
@@ -151,7 +189,7 @@ func TestResolveIncludesCycle(t *testing.T) {
 	rootPath := filepath.Join(dir, "root.md")
 	root := ":::include a.md"
 
-	_, _, err := resolveIncludes(root, dir, []string{rootPath})
+	_, _, err := resolveIncludes(root, dir, IncludeSearchDirs(nil), []string{rootPath})
 	if err == nil {
 		t.Fatal("expected a cycle error")
 	}
@@ -171,7 +209,7 @@ func TestResolveIncludesIgnoresFencedCode(t *testing.T) {
 		":::include chapter.md",
 	}, "\n")
 
-	got, included, err := resolveIncludes(root, dir, []string{filepath.Join(dir, "root.md")})
+	got, included, err := resolveIncludes(root, dir, IncludeSearchDirs(nil), []string{filepath.Join(dir, "root.md")})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -190,7 +228,7 @@ func TestResolveIncludesIgnoresFencedCode(t *testing.T) {
 func TestResolveIncludesNoIncludes(t *testing.T) {
 	dir := t.TempDir()
 	root := "# Just a heading\n\nNo includes here."
-	got, included, err := resolveIncludes(root, dir, []string{filepath.Join(dir, "root.md")})
+	got, included, err := resolveIncludes(root, dir, IncludeSearchDirs(nil), []string{filepath.Join(dir, "root.md")})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -201,3 +239,79 @@ func TestResolveIncludesNoIncludes(t *testing.T) {
 		t.Errorf("expected no includes, got %v", included)
 	}
 }
+
+func TestOpenMapsLinesThroughIncludes(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	write(t, dir, "ch.md", "---\ntitle: Chapter\n---\n# Chapter\n\nText.")
+	root := write(t, dir, "root.md", "---\nmdoc: true\n---\nIntro.\n\n:::include ch.md\n\nOutro.")
+	doc, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(doc.Body, "\n")
+	if len(doc.Lines) != len(lines) {
+		t.Fatalf("%d source lines for %d body lines", len(doc.Lines), len(lines))
+	}
+	ch := filepath.Join(dir, "ch.md")
+	for text, want := range map[string]SourceLine{
+		"Intro.":    {root, 4},
+		"# Chapter": {ch, 4},
+		"Text.":     {ch, 6},
+		"Outro.":    {root, 8},
+	} {
+		n := slices.Index(lines, text)
+		if n < 0 || doc.Lines[n] != want {
+			t.Errorf("%q: got %+v, want %+v", text, doc.Lines[max(n, 0)], want)
+		}
+	}
+}
+
+func TestOpenRebasesIncludedURLs(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	shared := t.TempDir()
+	write(t, dir, "chapters/02/method.md", strings.Join([]string{
+		"![Plot](img/plot.svg \"Plot\") and [data](../data.csv#top).",
+		"[web](https://example.com), [anchor](#method), [root](/x.png), `![](img/code.png)`",
+		`<img src="img/raw.png"> <a href='notes.md'>notes</a>`,
+		"[ref]: img/ref.png",
+		"```",
+		"![](img/fenced.png)",
+		"```",
+		":::include " + filepath.Join(shared, "logo.md"),
+	}, "\n"))
+	write(t, shared, "logo.md", "![](logo.png)")
+	root := write(t, dir, "root.md", "---\nmdoc: true\n---\n![](img/root.png)\n\n:::include chapters/02/method.md")
+	doc, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := "_/file/" + strings.TrimPrefix(filepath.ToSlash(shared), "/")
+	for _, want := range []string{
+		"![](img/root.png)",
+		`![Plot](chapters/02/img/plot.svg "Plot") and [data](chapters/data.csv#top).`,
+		"[web](https://example.com), [anchor](#method), [root](/x.png), `![](img/code.png)`",
+		`<img src="chapters/02/img/raw.png"> <a href='chapters/02/notes.md'>notes</a>`,
+		"[ref]: chapters/02/img/ref.png",
+		"![](img/fenced.png)",
+		"![](" + ext + "/logo.png)",
+	} {
+		if !strings.Contains(doc.Body, want) {
+			t.Errorf("missing %q in:\n%s", want, doc.Body)
+		}
+	}
+
+	if got, ok := AssetFile(dir, doc.Assets, "chapters/02/img/plot.svg"); !ok || got != filepath.Join(dir, "chapters", "02", "img", "plot.svg") {
+		t.Errorf("AssetFile(chapter image) = %q, %v", got, ok)
+	}
+	if got, ok := AssetFile(dir, doc.Assets, ext+"/logo.png"); !ok || got != filepath.Join(shared, "logo.png") {
+		t.Errorf("AssetFile(external image) = %q, %v", got, ok)
+	}
+	// Only the linked file itself: not its neighbours, nor the partial.
+	for _, rel := range []string{"../secret", ext + "/../secret", "_/file/etc/passwd", ext + "/logo.md", ext + "/secret.txt"} {
+		if got, ok := AssetFile(dir, doc.Assets, rel); ok {
+			t.Errorf("AssetFile(%q) = %q, want refused", rel, got)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+// Package funcs is the template function library shared by the markdown body
+// template and theme templates. Both see the same curated set, so a snippet
+// that works in one works in the other:
+//
+//	strings   upper lower title trim replace contains hasPrefix hasSuffix
+//	          split join truncate
+//	values    default empty coalesce
+//	numbers   add sub mul div sum number currency
+//	dates     date
+//	ranges    seq list dict keys column first last
+//	content   include markdown
+//
+// Functions that take a "subject" take it last, so they read naturally in a
+// pipeline: {{.Title | upper}}, {{.Tags | join ", "}}, {{.Author | default "Anon"}}.
+//
+// include and markdown depend on the document being rendered, so they are
+// bound per render through Env. Map(Env{}) still lists every name, which is
+// what template parsing needs; calling an unbound one is an error. date, number
+// and currency format in the document's language (see internal/locale).
+package funcs
+
+import (
+	"fmt"
+	htmltmpl "html/template"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hinkolas/mdoc/internal/locale"
+)
+
+// Env supplies the document-dependent functions.
+type Env struct {
+	// Include returns the content of a partial named by a key or path, resolved
+	// the way the calling template resolves includes.
+	Include func(target string) (htmltmpl.HTML, error)
+	// Markdown renders a markdown string to HTML.
+	Markdown func(src string) (htmltmpl.HTML, error)
+	// Lang is the document's language tag; empty means English.
+	Lang string
+}
+
+// Map returns the function library bound to env. The result can be passed to
+// both text/template's and html/template's Funcs.
+func Map(env Env) map[string]any {
+	loc := locale.Get(env.Lang)
+	return map[string]any{
+		"upper":     strings.ToUpper,
+		"lower":     strings.ToLower,
+		"title":     title,
+		"trim":      strings.TrimSpace,
+		"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":  func(sub, s string) bool { return strings.Contains(s, sub) },
+		"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":      join,
+		"truncate":  truncate,
+
+		"default":  deflt,
+		"empty":    empty,
+		"coalesce": coalesce,
+
+		"add":      func(a, b any) (any, error) { return arith(a, b, '+') },
+		"sub":      func(a, b any) (any, error) { return arith(a, b, '-') },
+		"mul":      func(a, b any) (any, error) { return arith(a, b, '*') },
+		"div":      func(a, b any) (any, error) { return arith(a, b, '/') },
+		"sum":      sum,
+		"number":   func(decimals int, v any) (string, error) { return number(loc, decimals, v) },
+		"currency": func(code string, v any) (string, error) { return currency(loc, code, v) },
+
+		"date": func(layout string, v any) (string, error) { return date(loc, layout, v) },
+
+		"seq":    seq,
+		"list":   func(items ...any) []any { return items },
+		"dict":   dict,
+		"keys":   keys,
+		"column": column,
+		"first":  first,
+		"last":   last,
+
+		"include": func(target string) (htmltmpl.HTML, error) {
+			if env.Include == nil {
+				return "", fmt.Errorf("include is not available here")
+			}
+			return env.Include(target)
+		},
+		"markdown": func(src string) (htmltmpl.HTML, error) {
+			if env.Markdown == nil {
+				return "", fmt.Errorf("markdown is not available here")
+			}
+			return env.Markdown(src)
+		},
+	}
+}
+
+// title upper-cases the first letter of every space-separated word.
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		start := unicode.IsSpace(prev)
+		prev = r
+		if start {
+			return unicode.ToUpper(r)
+		}
+		return r
+	}, s)
+}
+
+// join joins the elements of a list, formatted with fmt, with sep.
+func join(sep string, list any) (string, error) {
+	items, err := toList(list)
+	if err != nil {
+		return "", fmt.Errorf("join: %w", err)
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = fmt.Sprint(item)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// truncate shortens s to at most n runes, ending it with "…" when cut.
+func truncate(n int, s string) string {
+	if n < 1 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return strings.TrimRightFunc(string(r[:n-1]), unicode.IsSpace) + "…"
+}
+
+// deflt returns v, or def when v is empty (see empty).
+func deflt(def, v any) any {
+	if empty(v) {
+		return def
+	}
+	return v
+}
+
+// empty reports whether v is nil, false, zero, or an empty string, list or map.
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
+
+// coalesce returns the first non-empty argument, or nil.
+func coalesce(vs ...any) any {
+	for _, v := range vs {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// arith applies op to two numbers. Integers stay integers (except for a
+// division that doesn't come out even); anything else is computed as float64.
+// Numeric strings are accepted, so values from `data` work either way.
+func arith(a, b any, op rune) (any, error) {
+	ai, aInt := toInt(a)
+	bi, bInt := toInt(b)
+	if aInt && bInt {
+		switch op {
+		case '+':
+			return ai + bi, nil
+		case '-':
+			return ai - bi, nil
+		case '*':
+			return ai * bi, nil
+		case '/':
+			if bi == 0 {
+				return nil, fmt.Errorf("div: division by zero")
+			}
+			if ai%bi == 0 {
+				return ai / bi, nil
+			}
+		}
+	}
+	af, err := toFloat(a)
+	if err != nil {
+		return nil, err
+	}
+	bf, err := toFloat(b)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case '+':
+		return af + bf, nil
+	case '-':
+		return af - bf, nil
+	case '*':
+		return af * bf, nil
+	default:
+		if bf == 0 {
+			return nil, fmt.Errorf("div: division by zero")
+		}
+		return af / bf, nil
+	}
+}
+
+// sum adds up a list of numbers, or the values of a map.
+func sum(list any) (any, error) {
+	var items []any
+	if rv := reflect.ValueOf(list); rv.Kind() == reflect.Map {
+		for _, k := range rv.MapKeys() {
+			items = append(items, rv.MapIndex(k).Interface())
+		}
+	} else {
+		var err error
+		if items, err = toList(list); err != nil {
+			return nil, fmt.Errorf("sum: %w", err)
+		}
+	}
+	var total any = 0
+	for _, item := range items {
+		var err error
+		if total, err = arith(total, item, '+'); err != nil {
+			return nil, fmt.Errorf("sum: %w", err)
+		}
+	}
+	return total, nil
+}
+
+// number formats v with the given number of decimals and a thousands
+// separator: {{number 2 1234.5}} -> "1,234.50" ("1.234,50" in German).
+func number(loc locale.Pack, decimals int, v any) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", fmt.Errorf("number: %w", err)
+	}
+	return formatNumber(f, decimals, loc.Group, loc.Point), nil
+}
+
+// currencySymbols maps ISO 4217 codes to their symbols. Other codes are
+// printed as the code itself.
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// currency formats v as an amount in the given ISO 4217 currency with two
+// decimals: {{currency "EUR" 1234.5}} -> "€1,234.50" ("1.234,50 €" in German,
+// where the symbol follows the amount).
+func currency(loc locale.Pack, code string, v any) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", fmt.Errorf("currency: %w", err)
+	}
+	code = strings.ToUpper(code)
+	sym, ok := currencySymbols[code]
+	if !ok {
+		sym = code
+	}
+	amount := formatNumber(f, 2, loc.Group, loc.Point)
+	if loc.CurrencyAfter {
+		return amount + "\u00a0" + sym, nil
+	}
+	if !ok {
+		sym += " "
+	}
+	if f < 0 {
+		return "-" + sym + strings.TrimPrefix(amount, "-"), nil
+	}
+	return sym + amount, nil
+}
+
+// formatNumber renders f rounded to decimals places, grouping the integer part
+// in threes with group and separating the fraction with point.
+func formatNumber(f float64, decimals int, group, point string) string {
+	s := strconv.FormatFloat(math.Abs(f), 'f', max(decimals, 0), 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(group)
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(point)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// dateInputs are the string forms date parses, tried in order.
+var dateInputs = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// date formats a time with a named layout (iso, short, long, full; each
+// language has its own, see locale.Pack.Layouts) or a Go reference layout,
+// writing month and weekday names in the document's language. v is a time.Time
+// or a date string such as "2026-03-01" (as written in `data`):
+// {{date "long" .Data.due}}, {{.System.Now | date "iso"}}.
+func date(loc locale.Pack, layout string, v any) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", fmt.Errorf("date: %w", err)
+	}
+	if named, ok := loc.Layouts[layout]; ok {
+		layout = named
+	}
+	return loc.Format(t, layout), nil
+}
+
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t != nil {
+			return *t, nil
+		}
+	case string:
+		for _, layout := range dateInputs {
+			if parsed, err := time.Parse(layout, strings.TrimSpace(t)); err == nil {
+				return parsed, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot read %q as a date (use YYYY-MM-DD)", t)
+	}
+	return time.Time{}, fmt.Errorf("cannot read %v (%T) as a date", v, v)
+}
+
+// seq returns the integers 1..n for seq n, or a..b for seq a b (counting down
+// when b < a), for ranging a fixed number of times.
+func seq(bounds ...int) ([]int, error) {
+	var from, to int
+	switch len(bounds) {
+	case 1:
+		from, to = 1, bounds[0]
+	case 2:
+		from, to = bounds[0], bounds[1]
+	default:
+		return nil, fmt.Errorf("seq: want 1 or 2 arguments, got %d", len(bounds))
+	}
+	step := 1
+	if to < from {
+		step = -1
+	}
+	var out []int
+	for i := from; ; i += step {
+		out = append(out, i)
+		if i == to {
+			return out, nil
+		}
+	}
+}
+
+// dict builds a map from alternating keys and values, e.g. for passing several
+// values to a {{template}}: dict "name" .Title "year" 2026.
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		m[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// keys returns a map's keys, sorted.
+func keys(m any) ([]string, error) {
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map {
+		return nil, fmt.Errorf("keys: %T is not a map", m)
+	}
+	out := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		out = append(out, fmt.Sprint(k.Interface()))
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// column picks one field out of every row of a list of maps, e.g. a CSV
+// column for sum: sum (column "price" .Data.items). Rows without the field
+// contribute nil.
+func column(name string, rows any) ([]any, error) {
+	items, err := toList(rows)
+	if err != nil {
+		return nil, fmt.Errorf("column: %w", err)
+	}
+	out := make([]any, len(items))
+	for i, item := range items {
+		rv := reflect.ValueOf(item)
+		if rv.Kind() != reflect.Map {
+			return nil, fmt.Errorf("column: row %d is not a map", i+1)
+		}
+		if v := rv.MapIndex(reflect.ValueOf(name)); v.IsValid() {
+			out[i] = v.Interface()
+		}
+	}
+	return out, nil
+}
+
+func first(list any) (any, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func last(list any) (any, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+// toList converts any slice or array to []any.
+func toList(v any) ([]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%T is not a list", v)
+	}
+	out := make([]any, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, nil
+}
+
+func toInt(v any) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(rv.Uint()), true
+	case reflect.String:
+		i, err := strconv.ParseInt(strings.TrimSpace(rv.String()), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toFloat(v any) (float64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%v (%T) is not a number", v, v)
+}
@@ -0,0 +1,98 @@
+package funcs
+
+import (
+	"strings"
+	"testing"
+	texttmpl "text/template"
+	"time"
+)
+
+// run executes src as a text template with the function library and data.
+func run(t *testing.T, src string, data any) string {
+	t.Helper()
+	tmpl, err := texttmpl.New("t").Funcs(Map(Env{})).Parse(src)
+	if err != nil {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		t.Fatalf("execute %q: %v", src, err)
+	}
+	return b.String()
+}
+
+func TestFuncs(t *testing.T) {
+	data := map[string]any{
+		"Title": "annual report",
+		"Tags":  []string{"a", "b"},
+		"Items": []any{3, 4.5, "2"},
+		"Costs": map[string]any{"x": 10, "y": 5},
+		"Due":   "2026-03-01",
+		"Empty": "",
+		"Rows":  []any{map[string]any{"price": "10"}, map[string]any{"price": "2.5"}},
+		"Now":   time.Date(2026, 6, 11, 9, 0, 0, 0, time.UTC),
+	}
+	cases := []struct{ src, want string }{
+		{`{{.Title | upper}}`, "ANNUAL REPORT"},
+		{`{{.Title | title}}`, "Annual Report"},
+		{`{{.Title | replace "annual" "yearly"}}`, "yearly report"},
+		{`{{.Tags | join ", "}}`, "a, b"},
+		{`{{.Title | truncate 8}}`, "annual…"},
+		{`{{.Empty | default "none"}}`, "none"},
+		{`{{.Title | default "none"}}`, "annual report"},
+		{`{{coalesce .Empty .Missing "x"}}`, "x"},
+		{`{{add 2 3}} {{sub 2 3}} {{mul 2 1.5}} {{div 7 2}} {{div 8 2}}`, "5 -1 3 3.5 4"},
+		{`{{sum .Items}} {{sum .Costs}}`, "9.5 15"},
+		{`{{number 2 1234567.891}}`, "1,234,567.89"},
+		{`{{number 0 -1234.5}}`, "-1,234"},
+		{`{{currency "EUR" 1234.5}} {{currency "chf" -3}}`, "€1,234.50 -CHF 3.00"},
+		{`{{date "long" .Due}}`, "1 March 2026"},
+		{`{{.Now | date "iso"}} {{date "Jan 2" .Now}}`, "2026-06-11 Jun 11"},
+		{`{{range seq 3}}{{.}}{{end}} {{range seq 3 1}}{{.}}{{end}}`, "123 321"},
+		{`{{range keys .Costs}}{{.}}{{end}}`, "xy"},
+		{`{{with dict "a" 1 "b" 2}}{{.a}}{{.b}}{{end}}`, "12"},
+		{`{{first .Tags}}{{last .Tags}} {{len (list 1 2 3)}}`, "ab 3"},
+		{`{{sum (column "price" .Rows)}}`, "12.5"},
+		{`{{if empty .Empty}}yes{{end}}{{if contains "port" .Title}}!{{end}}`, "yes!"},
+	}
+	for _, c := range cases {
+		if got := run(t, c.src, data); got != c.want {
+			t.Errorf("%s = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestFuncsLocalized(t *testing.T) {
+	due := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct{ lang, src, want string }{
+		{"de", `{{date "long" .}} {{number 2 1234.5}} {{currency "EUR" 1234.5}}`, "1. März 2026 1.234,50 1.234,50\u00a0€"},
+		{"fr", `{{date "full" .}}`, "dimanche 1 mars 2026"},
+		{"es-MX", `{{date "long" .}} {{date "Jan" .}}`, "1 de marzo de 2026 mar"},
+		{"xx", `{{date "long" .}} {{currency "chf" -3}}`, "1 March 2026 -CHF 3.00"},
+	}
+	for _, c := range cases {
+		tmpl := texttmpl.Must(texttmpl.New("t").Funcs(Map(Env{Lang: c.lang})).Parse(c.src))
+		var b strings.Builder
+		if err := tmpl.Execute(&b, due); err != nil {
+			t.Fatalf("%s %s: %v", c.lang, c.src, err)
+		}
+		if got := b.String(); got != c.want {
+			t.Errorf("%s %s = %q, want %q", c.lang, c.src, got, c.want)
+		}
+	}
+}
+
+func TestFuncErrors(t *testing.T) {
+	for _, src := range []string{
+		`{{div 1 0}}`,
+		`{{add "x" 1}}`,
+		`{{date "long" "yesterday"}}`,
+		`{{dict "a"}}`,
+		`{{include "x"}}`, // unbound in Env{}
+	} {
+		tmpl := texttmpl.Must(texttmpl.New("t").Funcs(Map(Env{})).Parse(src))
+		if err := tmpl.Execute(&strings.Builder{}, nil); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package locale holds the built-in language packs selected by the `lang:`
+// frontmatter field. A pack supplies every string mdoc generates on its own —
+// caption words, callout titles, title page captions, the unresolved-reference
+// placeholder, the appendix prefix, the headings a document or theme writes
+// above a TOC or bibliography — plus the date layouts, month and weekday names,
+// and number separators the template functions format with.
+//
+// Packs exist for en, de, fr and es. A regional tag uses its base language
+// ("de-AT" -> de); anything unknown falls back to English, so a document can
+// still declare its language for hyphenation without mdoc knowing it.
+package locale
+
+import (
+	"maps"
+	"strings"
+	"time"
+)
+
+// DefaultLang is the language of documents that don't set `lang`.
+const DefaultLang = "en"
+
+// Pack is one language's generated strings and formats.
+type Pack struct {
+	// Lang is the pack's base language tag, e.g. "de".
+	Lang string
+	// Labels are the generated strings by key:
+	//
+	//	figure, table   caption words ("Figure 2.1")
+	//	figures, tables list-of-figures/tables headings
+	//	contents        table-of-contents heading
+	//	references      bibliography heading
+	//	appendix        prefix of appendix chapter numbers ("Appendix A")
+	//	page            the word "page", for page references
+	//	unresolved      placeholder for a reference that resolves to nothing
+	//	note, tip, important, warning, caution
+	//	                default titles of the callout blocks
+	//	supervisor, abstract
+	//	                title page captions
+	//
+	// The `labels` frontmatter field overrides individual keys (see WithLabels).
+	Labels map[string]string
+	// Layouts are the named layouts of the `date` template function (iso,
+	// short, long, full) as Go reference layouts.
+	Layouts map[string]string
+	// Date and Time are the layouts of {{.System.Date}} and {{.System.Time}}.
+	Date, Time string
+	// Months, ShortMonths, Days and ShortDays replace the English names Go
+	// writes for the January/Jan/Monday/Mon layout elements.
+	Months, ShortMonths [12]string
+	Days, ShortDays     [7]string // Sunday first, as time.Weekday
+	// Group and Point separate thousands and the fraction in formatted numbers.
+	Group, Point string
+	// CurrencyAfter places the currency symbol after the amount ("12,50 €").
+	CurrencyAfter bool
+	// Quotes are the typographic quotes of the smart-typography pass: opening
+	// and closing double, then opening and closing single.
+	Quotes [4]string
+	// Abbrevs are the words a number is tied to with a no-break space by the
+	// smart-typography pass, so "Abb. 2" or "page 4" never breaks across lines.
+	Abbrevs []string
+}
+
+var english = Pack{
+	Lang: "en",
+	Labels: map[string]string{
+		"figure":     "Figure",
+		"table":      "Table",
+		"figures":    "List of Figures",
+		"tables":     "List of Tables",
+		"contents":   "Contents",
+		"references": "References",
+		"appendix":   "Appendix",
+		"page":       "page",
+		"unresolved": "[?]",
+		"note":       "Note",
+		"tip":        "Tip",
+		"important":  "Important",
+		"warning":    "Warning",
+		"caution":    "Caution",
+		"supervisor": "Supervisor",
+		"abstract":   "Abstract",
+	},
+	Layouts: map[string]string{
+		"iso":   "2006-01-02",
+		"short": "2 Jan 2006",
+		"long":  "2 January 2006",
+		"full":  "Monday, 2 January 2006",
+	},
+	Date:        "02 January 2006",
+	Time:        "15:04:05",
+	Months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	ShortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	Days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	ShortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	Group:       ",",
+	Point:       ".",
+	Quotes:      [4]string{"“", "”", "‘", "’"},
+	Abbrevs:     []string{"Fig.", "Figs.", "Figure", "Tab.", "Table", "Eq.", "Sec.", "Section", "Ch.", "Chapter", "Appendix", "No.", "p.", "pp.", "page", "vol.", "§"},
+}
+
+var packs = map[string]Pack{
+	"en": english,
+	"de": {
+		Lang: "de",
+		Labels: map[string]string{
+			"figure":     "Abbildung",
+			"table":      "Tabelle",
+			"figures":    "Abbildungsverzeichnis",
+			"tables":     "Tabellenverzeichnis",
+			"contents":   "Inhaltsverzeichnis",
+			"references": "Literaturverzeichnis",
+			"appendix":   "Anhang",
+			"page":       "Seite",
+			"unresolved": "[?]",
+			"note":       "Hinweis",
+			"tip":        "Tipp",
+			"important":  "Wichtig",
+			"warning":    "Warnung",
+			"caution":    "Vorsicht",
+			"supervisor": "Betreuer",
+			"abstract":   "Zusammenfassung",
+		},
+		Layouts: map[string]string{
+			"iso":   "2006-01-02",
+			"short": "2. Jan 2006",
+			"long":  "2. January 2006",
+			"full":  "Monday, 2. January 2006",
+		},
+		Date:          "02. January 2006",
+		Time:          "15:04:05",
+		Months:        [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		ShortMonths:   [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sep.", "Okt.", "Nov.", "Dez."},
+		Days:          [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		ShortDays:     [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		Group:         ".",
+		Point:         ",",
+		CurrencyAfter: true,
+		Quotes:        [4]string{"„", "“", "‚", "‘"},
+		Abbrevs:       []string{"Abb.", "Abbildung", "Tab.", "Tabelle", "Kap.", "Kapitel", "Abschnitt", "Anhang", "Abs.", "Art.", "Bd.", "Gl.", "Nr.", "S.", "Seite", "§"},
+	},
+	"fr": {
+		Lang: "fr",
+		Labels: map[string]string{
+			"figure":     "Figure",
+			"table":      "Tableau",
+			"figures":    "Table des figures",
+			"tables":     "Liste des tableaux",
+			"contents":   "Table des matières",
+			"references": "Bibliographie",
+			"appendix":   "Annexe",
+			"page":       "page",
+			"unresolved": "[?]",
+			"note":       "Remarque",
+			"tip":        "Astuce",
+			"important":  "Important",
+			"warning":    "Avertissement",
+			"caution":    "Attention",
+			"supervisor": "Encadrant",
+			"abstract":   "Résumé",
+		},
+		Layouts: map[string]string{
+			"iso":   "2006-01-02",
+			"short": "2 Jan 2006",
+			"long":  "2 January 2006",
+			"full":  "Monday 2 January 2006",
+		},
+		Date:          "02 January 2006",
+		Time:          "15:04:05",
+		Months:        [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		ShortMonths:   [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		Days:          [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		ShortDays:     [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		Group:         "\u202f", // narrow no-break space
+		Point:         ",",
+		CurrencyAfter: true,
+		Quotes:        [4]string{"«\u202f", "\u202f»", "“", "”"},
+		Abbrevs:       []string{"fig.", "Fig.", "Figure", "tab.", "Tableau", "chap.", "Chapitre", "Section", "Annexe", "éq.", "n°", "p.", "page", "§"},
+	},
+	"es": {
+		Lang: "es",
+		Labels: map[string]string{
+			"figure":     "Figura",
+			"table":      "Tabla",
+			"figures":    "Índice de figuras",
+			"tables":     "Índice de tablas",
+			"contents":   "Índice",
+			"references": "Referencias",
+			"appendix":   "Apéndice",
+			"page":       "página",
+			"unresolved": "[?]",
+			"note":       "Nota",
+			"tip":        "Consejo",
+			"important":  "Importante",
+			"warning":    "Advertencia",
+			"caution":    "Precaución",
+			"supervisor": "Tutor",
+			"abstract":   "Resumen",
+		},
+		Layouts: map[string]string{
+			"iso":   "2006-01-02",
+			"short": "2 Jan 2006",
+			"long":  "2 de January de 2006",
+			"full":  "Monday, 2 de January de 2006",
+		},
+		Date:          "02 de January de 2006",
+		Time:          "15:04:05",
+		Months:        [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		ShortMonths:   [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		Days:          [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		ShortDays:     [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		Group:         ".",
+		Point:         ",",
+		CurrencyAfter: true,
+		Quotes:        [4]string{"«", "»", "“", "”"},
+		Abbrevs:       []string{"fig.", "Fig.", "Figura", "tab.", "Tabla", "cap.", "Capítulo", "Sección", "Apéndice", "ec.", "núm.", "p.", "pág.", "página", "§"},
+	},
+}
+
+// Get returns the pack for a language tag. The tag's base language picks the
+// pack ("de-AT" and "de_CH" use de); an empty or unknown tag gets English.
+func Get(lang string) Pack {
+	if p, ok := packs[base(lang)]; ok {
+		return p
+	}
+	return english
+}
+
+// Known reports whether lang has a built-in pack of its own rather than
+// falling back to English.
+func Known(lang string) bool {
+	_, ok := packs[base(lang)]
+	return ok
+}
+
+// base returns the lower-cased primary subtag of a language tag.
+func base(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+// Label returns the string for a label key, or "" for an unknown key.
+func (p Pack) Label(key string) string { return p.Labels[key] }
+
+// WithLabels returns a copy of p whose labels are overridden by the non-empty
+// entries of overrides, as the `labels` frontmatter field does. p itself is
+// left untouched.
+func (p Pack) WithLabels(overrides map[string]string) Pack {
+	p.Labels = maps.Clone(p.Labels)
+	for k, v := range overrides {
+		if v != "" {
+			p.Labels[k] = v
+		}
+	}
+	return p
+}
+
+// Format formats t with a Go reference layout, writing month and weekday names
+// in the pack's language: Get("de").Format(t, "2. January 2006") -> "1. März
+// 2026".
+func (p Pack) Format(t time.Time, layout string) string {
+	var b strings.Builder
+	lit := 0 // start of the pending run of layout handled by time.Format
+	for i := 0; i < len(layout); {
+		name, n := p.nameAt(t, layout[i:])
+		if n == 0 {
+			i++
+			continue
+		}
+		b.WriteString(t.Format(layout[lit:i]))
+		b.WriteString(name)
+		i += n
+		lit = i
+	}
+	b.WriteString(t.Format(layout[lit:]))
+	return b.String()
+}
+
+// nameAt reports whether s starts with a month or weekday layout element and,
+// if so, returns t's name for it and the element's length. Like time.Format,
+// "Jan" and "Mon" only count when not followed by a lower-case letter, so
+// "Month" stays literal text.
+func (p Pack) nameAt(t time.Time, s string) (string, int) {
+	switch {
+	case strings.HasPrefix(s, "January"):
+		return p.Months[t.Month()-1], len("January")
+	case strings.HasPrefix(s, "Monday"):
+		return p.Days[t.Weekday()], len("Monday")
+	case strings.HasPrefix(s, "Jan") && !lowerAt(s, 3):
+		return p.ShortMonths[t.Month()-1], len("Jan")
+	case strings.HasPrefix(s, "Mon") && !lowerAt(s, 3):
+		return p.ShortDays[t.Weekday()], len("Mon")
+	}
+	return "", 0
+}
+
+func lowerAt(s string, i int) bool { return i < len(s) && s[i] >= 'a' && s[i] <= 'z' }
@@ -0,0 +1,51 @@
+package locale
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	for lang, want := range map[string]string{
+		"":      "en",
+		"de":    "de",
+		"de-AT": "de",
+		"FR_ca": "fr",
+		"it":    "en",
+	} {
+		if got := Get(lang).Lang; got != want {
+			t.Errorf("Get(%q).Lang = %q, want %q", lang, got, want)
+		}
+	}
+	if Known("it") || !Known("es-ES") {
+		t.Error("Known: want it unknown and es-ES known")
+	}
+}
+
+func TestWithLabelsOverridesPerKey(t *testing.T) {
+	de := Get("de")
+	p := de.WithLabels(map[string]string{"figure": "Abb.", "table": "", "extra": "x"})
+	if p.Label("figure") != "Abb." || p.Label("table") != "Tabelle" || p.Label("extra") != "x" {
+		t.Errorf("labels = %v", p.Labels)
+	}
+	if de.Label("figure") != "Abbildung" {
+		t.Error("WithLabels modified the built-in pack")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	d := time.Date(2026, 5, 4, 9, 30, 0, 0, time.UTC) // a Monday
+	cases := []struct{ lang, layout, want string }{
+		{"en", "Monday, 2 January 2006", "Monday, 4 May 2026"},
+		{"de", "Mon 2. Jan 2006, 15:04", "Mo. 4. Mai 2026, 09:30"},
+		{"de", "02. January 2006", "04. Mai 2026"},
+		{"fr", "Monday 2 January", "lundi 4 mai"},
+		{"es", "2 de January de 2006", "4 de mayo de 2026"},
+		{"de", "Month: 01", "Month: 05"}, // "Mon" followed by a lower-case letter is literal
+	}
+	for _, c := range cases {
+		if got := Get(c.lang).Format(d, c.layout); got != c.want {
+			t.Errorf("%s %q = %q, want %q", c.lang, c.layout, got, c.want)
+		}
+	}
+}
@@ -1,17 +1,22 @@
 package mdext
 
 import (
+	"strconv"
+
 	"github.com/hinkolas/mdoc/internal/document"
 	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
 )
 
 // Directive is a single-line `:::name [arg] [key=value …]` leaf block (toc,
-// bibliography, lof, lot, page, and the matter markers). The block parser fills
+// bibliography, lof, lot, endnotes, page, column-break, titlepage, and the
+// matter markers). The block parser fills
 // Name/Arg/Options; the AST transformer fills Headings (name=="toc"), Bib
 // (name=="bibliography"), or Entries (name=="lof"/"lot") so the renderer can
 // emit them without a parser.Context.
 type Directive struct {
 	gast.BaseBlock
+	opener
 	Name     string
 	Arg      string // trailing token on the open line, e.g. `:::page cover`
 	Options  map[string]string
@@ -36,12 +41,24 @@ func NewDirective(name string) *Directive {
 	return &Directive{Name: name, Options: map[string]string{}}
 }
 
+// opener records where a directive's opening line starts in the source, so
+// the block has a position (see source.go) even when it holds no text. Blocks
+// mdoc makes up itself, such as a converted GitHub alert, have none.
+type opener struct {
+	start int
+	known bool
+}
+
+func (o *opener) setStart(pos int) { o.start, o.known = pos, true }
+
+func (o *opener) sourceStart() (int, bool) { return o.start, o.known }
+
 // HeadingEntry is one collected heading, used to build a table of contents.
 type HeadingEntry struct {
-	Level  int
-	Number string // "2.1" / "A.1"; empty when the heading is {.unnumbered}
-	Title  string // plain text, without the number
-	ID     string
+	Level  int    `json:"level"`
+	Number string `json:"number"` // "2.1" / "A.1"; empty when the heading is {.unnumbered}
+	Title  string `json:"title"`  // plain text, without the number
+	ID     string `json:"id"`
 }
 
 // BibEntry is one numbered, cited reference, used to build a bibliography.
@@ -79,10 +96,14 @@ func NewCitation(key, locator string) *Citation {
 }
 
 // SecNum is the section number injected as a numbered heading's first inline
-// child, e.g. the "2.1" in "<h2>2.1 Title</h2>".
+// child, e.g. the "2.1" in "<h2>2.1 Title</h2>". Prefix is the word an appendix
+// chapter's number carries ("Appendix"), rendered as a data-prefix attribute
+// themes can show with `attr(data-prefix)` so the number itself — reused in the
+// TOC and cross-references — stays bare.
 type SecNum struct {
 	gast.BaseInline
-	Num string
+	Num    string
+	Prefix string
 }
 
 // KindSecNum is the NodeKind of a SecNum node.
@@ -93,7 +114,7 @@ func (n *SecNum) Kind() gast.NodeKind { return KindSecNum }
 
 // Dump implements ast.Node.Dump.
 func (n *SecNum) Dump(source []byte, level int) {
-	gast.DumpHelper(n, source, level, map[string]string{"Num": n.Num}, nil)
+	gast.DumpHelper(n, source, level, map[string]string{"Num": n.Num, "Prefix": n.Prefix}, nil)
 }
 
 // NewSecNum returns a SecNum carrying the given number text.
@@ -143,10 +164,12 @@ type CaptionEntry struct {
 // from caption (a Caption child), and injects the "Abbildung 2.1" label.
 type Captioned struct {
 	gast.BaseBlock
+	opener
 	Variant string // "figure" | "table"
 	ID      string
 	Number  string
 	Options map[string]string
+	fence   int // colons of the opening fence; the closing one needs as many
 }
 
 // KindCaptioned is the NodeKind of a Captioned node.
@@ -235,3 +258,170 @@ func (n *Xref) Dump(source []byte, level int) {
 
 // NewXref returns an Xref to the given id in the given mode ("num" | "page").
 func NewXref(id, mode string) *Xref { return &Xref{ID: id, Mode: mode} }
+
+// Note is a footnote set at its reference: the note's text as an inline
+// `<span class="mdoc-footnote">` the theme floats to the bottom of the page with
+// paged.js `float: footnote`, which also draws the call number in the text.
+type Note struct {
+	gast.BaseInline
+	ID string
+}
+
+// KindNote is the NodeKind of a Note node.
+var KindNote = gast.NewNodeKind("Note")
+
+// Kind implements ast.Node.Kind.
+func (n *Note) Kind() gast.NodeKind { return KindNote }
+
+// Dump implements ast.Node.Dump.
+func (n *Note) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"ID": n.ID}, nil)
+}
+
+// NewNote returns an empty Note with the given element id.
+func NewNote(id string) *Note { return &Note{ID: id} }
+
+// NoteRef is a second reference to a footnote already set as a Note. It renders
+// as an empty `mdoc-noteref` link the theme fills with the note's number via
+// target-counter, like a page reference.
+type NoteRef struct {
+	gast.BaseInline
+	ID string
+}
+
+// KindNoteRef is the NodeKind of a NoteRef node.
+var KindNoteRef = gast.NewNodeKind("NoteRef")
+
+// Kind implements ast.Node.Kind.
+func (n *NoteRef) Kind() gast.NodeKind { return KindNoteRef }
+
+// Dump implements ast.Node.Dump.
+func (n *NoteRef) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"ID": n.ID}, nil)
+}
+
+// NewNoteRef returns a NoteRef to the Note with the given element id.
+func NewNoteRef(id string) *NoteRef { return &NoteRef{ID: id} }
+
+// Sidenote is an inline `[>note text]` margin note; its children are the note's
+// text. The transformer numbers it unless it was written `[>{-} …]`.
+type Sidenote struct {
+	gast.BaseInline
+	Numbered bool
+	Number   int
+	open     text.Segment // the `[>` opener, restored as text if never closed
+}
+
+// KindSidenote is the NodeKind of a Sidenote node.
+var KindSidenote = gast.NewNodeKind("Sidenote")
+
+// Kind implements ast.Node.Kind.
+func (n *Sidenote) Kind() gast.NodeKind { return KindSidenote }
+
+// Dump implements ast.Node.Dump.
+func (n *Sidenote) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Number": strconv.Itoa(n.Number)}, nil)
+}
+
+// NewSidenote returns an empty Sidenote.
+func NewSidenote(numbered bool) *Sidenote { return &Sidenote{Numbered: numbered} }
+
+// Callout is a `:::note`, `:::tip`, `:::important`, `:::warning` or
+// `:::caution` block, or a GitHub `> [!NOTE]` alert. Its first child is a
+// CalloutTitle and the rest is the body.
+type Callout struct {
+	gast.BaseBlock
+	opener
+	Variant string // "note" | "tip" | "important" | "warning" | "caution"
+	ID      string
+	fence   int
+}
+
+// KindCallout is the NodeKind of a Callout node.
+var KindCallout = gast.NewNodeKind("Callout")
+
+// Kind implements ast.Node.Kind.
+func (n *Callout) Kind() gast.NodeKind { return KindCallout }
+
+// Dump implements ast.Node.Dump.
+func (n *Callout) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Variant": n.Variant}, nil)
+}
+
+// NewCallout returns an empty Callout of the given variant.
+func NewCallout(variant string) *Callout { return &Callout{Variant: variant} }
+
+// CalloutTitle is a callout's title: the inline markdown after the directive
+// name (`:::warning Mind *the* gap`), or the variant's label in the document's
+// language ("Warning", "Warnung") when the title is left out.
+type CalloutTitle struct {
+	gast.BaseBlock
+}
+
+// KindCalloutTitle is the NodeKind of a CalloutTitle node.
+var KindCalloutTitle = gast.NewNodeKind("CalloutTitle")
+
+// Kind implements ast.Node.Kind.
+func (n *CalloutTitle) Kind() gast.NodeKind { return KindCalloutTitle }
+
+// Dump implements ast.Node.Dump.
+func (n *CalloutTitle) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+// NewCalloutTitle returns an empty CalloutTitle.
+func NewCalloutTitle() *CalloutTitle { return &CalloutTitle{} }
+
+// Block is a `:::name … :::` directive mdoc doesn't know itself (`:::abstract`,
+// `:::signature`), rendered as a div a theme can style. Without a closing fence
+// it is an empty leaf.
+type Block struct {
+	gast.BaseBlock
+	opener
+	Name    string
+	ID      string
+	Arg     string            // first bare token on the open line
+	Options map[string]string // key=value options, rendered as data-* attributes
+	fence   int               // 0 for a leaf
+}
+
+// KindBlock is the NodeKind of a Block node.
+var KindBlock = gast.NewNodeKind("Block")
+
+// Kind implements ast.Node.Kind.
+func (n *Block) Kind() gast.NodeKind { return KindBlock }
+
+// Dump implements ast.Node.Dump.
+func (n *Block) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Name": n.Name}, nil)
+}
+
+// NewBlock returns an empty Block with the given name.
+func NewBlock(name string) *Block {
+	return &Block{Name: name, Options: map[string]string{}}
+}
+
+// Columns is a `:::columns n=2 gap=8mm … :::` block, set in CSS columns. A
+// `:::column-break` directive inside it starts the next column. page.columns
+// wraps the whole body in one.
+type Columns struct {
+	gast.BaseBlock
+	opener
+	Count int    // number of columns, 2 unless n= says otherwise
+	Gap   string // CSS column-gap; empty leaves it to the theme
+	fence int
+}
+
+// KindColumns is the NodeKind of a Columns node.
+var KindColumns = gast.NewNodeKind("Columns")
+
+// Kind implements ast.Node.Kind.
+func (n *Columns) Kind() gast.NodeKind { return KindColumns }
+
+// Dump implements ast.Node.Dump.
+func (n *Columns) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Count": strconv.Itoa(n.Count)}, nil)
+}
+
+// NewColumns returns an empty Columns block of count columns.
+func NewColumns(count int) *Columns { return &Columns{Count: count} }
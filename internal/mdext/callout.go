@@ -0,0 +1,98 @@
+package mdext
+
+import (
+	"slices"
+	"strings"
+
+	gast "github.com/yuin/goldmark/ast"
+)
+
+// callout.go turns GitHub alerts into Callouts and gives every callout its
+// title. An alert is a blockquote whose first line is only the marker:
+//
+//	> [!WARNING]
+//	> Mind the gap.
+//
+// The marker is case-insensitive and names one of the callout variants; any
+// other blockquote is left alone.
+
+// alertVariant returns the callout variant a blockquote's first line marks, or
+// "" when it isn't an alert.
+func alertVariant(q *gast.Blockquote, source []byte) string {
+	p, ok := q.FirstChild().(*gast.Paragraph)
+	if !ok || p.Lines().Len() == 0 {
+		return ""
+	}
+	line := p.Lines().At(0)
+	first := strings.TrimSpace(string(line.Value(source)))
+	inner, ok := strings.CutPrefix(first, "[!")
+	if !ok {
+		return ""
+	}
+	inner, ok = strings.CutSuffix(inner, "]")
+	if !ok || !slices.Contains(calloutKinds, strings.ToLower(inner)) {
+		return ""
+	}
+	return strings.ToLower(inner)
+}
+
+// convertAlerts replaces GitHub alert blockquotes with Callouts holding the
+// quote's content minus the marker line.
+func convertAlerts(doc *gast.Document, source []byte) {
+	var quotes []*gast.Blockquote
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if q, ok := n.(*gast.Blockquote); ok && entering && alertVariant(q, source) != "" {
+			quotes = append(quotes, q)
+		}
+		return gast.WalkContinue, nil
+	})
+	for _, q := range quotes {
+		c := NewCallout(alertVariant(q, source))
+		p := q.FirstChild().(*gast.Paragraph)
+		dropFirstLine(p)
+		if p.FirstChild() == nil {
+			q.RemoveChild(q, p)
+		}
+		for ch := q.FirstChild(); ch != nil; {
+			next := ch.NextSibling()
+			c.AppendChild(c, ch) // re-parents (detaches from q)
+			ch = next
+		}
+		q.Parent().ReplaceChild(q.Parent(), q, c)
+	}
+}
+
+// dropFirstLine removes the inlines of a paragraph's first line. The line holds
+// only the alert marker, which parses as plain text.
+func dropFirstLine(p *gast.Paragraph) {
+	end := p.Lines().At(0).Stop
+	for ch := p.FirstChild(); ch != nil; {
+		next := ch.NextSibling()
+		p.RemoveChild(p, ch)
+		if t, ok := ch.(*gast.Text); !ok || t.SoftLineBreak() || t.HardLineBreak() || t.Segment.Stop >= end {
+			break
+		}
+		ch = next
+	}
+}
+
+// titleCallouts gives every callout without a title of its own the default
+// title of its variant.
+func (t *transformer) titleCallouts(doc *gast.Document) {
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		c, ok := n.(*Callout)
+		if !ok || !entering {
+			return gast.WalkContinue, nil
+		}
+		if _, titled := c.FirstChild().(*CalloutTitle); !titled {
+			title := NewCalloutTitle()
+			title.AppendChild(title, gast.NewString([]byte(t.cfg.label(c.Variant))))
+			if c.FirstChild() != nil {
+				c.InsertBefore(c, c.FirstChild(), title)
+			} else {
+				c.AppendChild(c, title)
+			}
+		}
+		return gast.WalkContinue, nil
+	})
+}
@@ -4,34 +4,71 @@ import (
 	"strings"
 
 	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
 )
 
-// citationParser parses inline `[@key]` citations and `[#id]` cross-references.
-// It triggers on '[' but returns nil for anything that isn't `[@…` or `[#…`, so
-// ordinary links (`[text](url)`) and footnotes (`[^id]`) fall through to their
-// own parsers. Register it at a higher priority (lower number) than those.
+// citationParser parses inline `[@key]` citations, `[#id]` cross-references,
+// and `[>note]` sidenotes (see sidenote.go). It triggers on '[' but returns nil
+// for anything that isn't `[@…`, `[#…` or `[>…`, so ordinary links
+// (`[text](url)`) and footnotes (`[^id]`) fall through to their own parsers.
+// Register it at a higher priority (lower number) than those. It also sees
+// every ']' and '![' first, to find the end of an open sidenote.
 type citationParser struct{}
 
-// NewCitationParser returns the `[@key]` / `[#id]` inline parser.
+// footnoteRefs parses `[^id]` footnote references for citationParser, which
+// has to know whether one inside a note claims its ']'.
+var footnoteRefs = extension.NewFootnoteParser()
+
+// NewCitationParser returns the `[@key]` / `[#id]` / `[>note]` inline parser.
 func NewCitationParser() parser.InlineParser { return &citationParser{} }
 
-func (s *citationParser) Trigger() []byte { return []byte{'['} }
+func (s *citationParser) Trigger() []byte { return []byte{'[', ']', '!'} }
 
 func (s *citationParser) Parse(parent gast.Node, block text.Reader, pc parser.Context) gast.Node {
-	line, _ := block.PeekLine()
-	if len(line) < 4 || line[0] != '[' {
+	line, segment := block.PeekLine()
+	switch {
+	case len(line) == 0:
+		return nil
+	case line[0] == ']':
+		return closeSidenote(parent, block, pc)
+	case line[0] == '!':
+		if len(line) > 1 && line[1] == '[' {
+			countBracket(pc) // an image's alt text
+		}
+		return nil
+	case len(line) < 3:
+		countBracket(pc)
 		return nil
 	}
+	var node gast.Node
 	switch line[1] {
 	case '@':
-		return parseCitation(line, block)
+		node = parseCitation(line, block)
 	case '#':
-		return parseXref(line, block)
-	default:
-		return nil
+		node = parseXref(line, block)
+	case '>':
+		if sidenoteOf(pc) == nil {
+			node = openSidenote(line, segment, block, pc)
+		}
+	case '^':
+		// A footnote reference consumes its own ']', but only when it names a
+		// defined footnote; an undefined one is a '[' left to the link parser.
+		// Inside a note the difference matters, so ask the footnote parser now.
+		if sidenoteOf(pc) == nil {
+			return nil
+		}
+		l, pos := block.Position()
+		if node = footnoteRefs.Parse(parent, block, pc); node != nil {
+			return node
+		}
+		block.SetPosition(l, pos)
+	}
+	if node == nil {
+		countBracket(pc)
 	}
+	return node
 }
 
 // closeBracket returns the index of the closing ']' on the same line, or -1.
@@ -1,31 +1,73 @@
 package mdext
 
 import (
+	"bytes"
+	"slices"
+	"strconv"
 	"strings"
+	"unicode"
 
 	gast "github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 )
 
 // containerDirectives are the `:::name … :::` directives that carry a markdown
-// body (closed by a bare `:::` fence). Everything else is a single-line leaf.
+// body (closed by a bare `:::` fence).
 var containerDirectives = map[string]bool{
-	"figure": true,
-	"table":  true,
+	"figure":    true,
+	"table":     true,
+	"note":      true,
+	"tip":       true,
+	"important": true,
+	"warning":   true,
+	"caution":   true,
 }
 
+// leafDirectives are the built-in single-line directives. Any other name is a
+// theme-defined Block: a container when a closing fence follows, else a leaf.
+var leafDirectives = map[string]bool{
+	"toc":          true,
+	"bibliography": true,
+	"lof":          true,
+	"lot":          true,
+	"endnotes":     true,
+	"page":         true,
+	"column-break": true,
+	"titlepage":    true,
+	"frontmatter":  true,
+	"mainmatter":   true,
+	"appendix":     true,
+	"include":      true,
+}
+
+// calloutKinds are the callout containers, in the order GitHub lists its alerts.
+var calloutKinds = []string{"note", "tip", "important", "warning", "caution"}
+
 // directiveParser parses `:::…` directives. Most are single-line leaf blocks —
-// toc, bibliography, lof, lot, page, and the matter markers (frontmatter /
-// mainmatter / appendix) — so a marker never swallows the content that follows
-// it. Options are inline:
+// toc, bibliography, lof, lot, endnotes, page, titlepage, and the matter markers
+// (frontmatter / mainmatter / appendix) — so a marker never swallows the content
+// that follows it. Options are inline, with a value that holds blanks in
+// double quotes:
 //
 //	:::toc depth=3
 //	:::page cover
-//	:::frontmatter
+//	:::signature label="Signed by"
 //
-// figure and table are containers: `:::figure #id` opens a block whose markdown
-// body (image/table media plus a rich caption) runs until a closing `:::`.
+// figure, table and columns are containers: `:::figure #id` opens a block
+// whose markdown body (image/table media plus a rich caption) runs until a
+// closing `:::`, and `:::columns n=2 gap=8mm` sets its body in columns
+// (`:::column-break` starts the next one). The callouts (note, tip, important,
+// warning, caution) are containers too, with an optional title after the name:
+// `:::warning Mind the gap`.
+//
+// Any other name is a generic Block for themes to style (`:::abstract`,
+// `:::signature lines=2`): a container when a closing fence follows it, and an
+// empty leaf otherwise. A closing fence needs at least as many colons as its
+// opener and closes the innermost open container, so containers nest with
+// plain `:::` fences; more colons on the outer one just read better:
+// `::::note` … `:::figure` … `:::` … `::::`.
 type directiveParser struct{}
 
 // NewDirectiveParser returns the `:::…` directive block parser.
@@ -34,7 +76,7 @@ func NewDirectiveParser() parser.BlockParser { return &directiveParser{} }
 func (b *directiveParser) Trigger() []byte { return []byte{':'} }
 
 func (b *directiveParser) Open(parent gast.Node, reader text.Reader, pc parser.Context) (gast.Node, parser.State) {
-	line, _ := reader.PeekLine()
+	line, segment := reader.PeekLine()
 	pos := pc.BlockIndent()
 	if pos < 0 {
 		return nil, parser.NoChildren
@@ -45,14 +87,38 @@ func (b *directiveParser) Open(parent gast.Node, reader text.Reader, pc parser.C
 	if i-pos < 3 {
 		return nil, parser.NoChildren
 	}
-	fields := strings.Fields(string(line[i:]))
+	fields := directiveFields(string(line[i:]))
 	if len(fields) == 0 {
 		return nil, parser.NoChildren
 	}
 	name := fields[0]
+	fence := i - pos
+
+	if slices.Contains(calloutKinds, name) {
+		node := NewCallout(name)
+		node.fence = fence
+		node.setStart(segment.Start)
+		// The rest of the line, after an optional #id, is the title; its
+		// lines are parsed as inline markdown like a paragraph's.
+		rest := skipSpace(line, skipWord(line, skipSpace(line, i)))
+		if rest < len(line) && line[rest] == '#' {
+			end := skipWord(line, rest)
+			node.ID = string(line[rest+1 : end])
+			rest = skipSpace(line, end)
+		}
+		if title := util.TrimRightSpace(line[rest:]); len(title) > 0 {
+			t := NewCalloutTitle()
+			t.Lines().Append(text.NewSegment(segment.Start+rest, segment.Start+rest+len(title)))
+			node.AppendChild(node, t)
+		}
+		reader.AdvanceToEOL()
+		return node, parser.HasChildren
+	}
 
 	if containerDirectives[name] {
 		node := NewCaptioned(name)
+		node.fence = fence
+		node.setStart(segment.Start)
 		for _, f := range fields[1:] {
 			if id, ok := strings.CutPrefix(f, "#"); ok {
 				node.ID = id
@@ -66,7 +132,52 @@ func (b *directiveParser) Open(parent gast.Node, reader text.Reader, pc parser.C
 		return node, parser.HasChildren
 	}
 
+	if name == "columns" {
+		node := NewColumns(2)
+		node.fence = fence
+		node.setStart(segment.Start)
+		for _, f := range fields[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			switch strings.TrimSpace(k) {
+			case "n":
+				if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+					node.Count = n
+				}
+			case "gap":
+				node.Gap = strings.TrimSpace(v)
+			}
+		}
+		reader.AdvanceToEOL()
+		return node, parser.HasChildren
+	}
+
+	if !leafDirectives[name] {
+		node := NewBlock(name)
+		node.setStart(segment.Start)
+		for _, f := range fields[1:] {
+			if id, ok := strings.CutPrefix(f, "#"); ok {
+				node.ID = id
+			} else if k, v, ok := strings.Cut(f, "="); ok {
+				node.Options[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			} else if node.Arg == "" {
+				node.Arg = f
+			}
+		}
+		reader.AdvanceToEOL()
+		closed, _ := pc.Get(closedOpenersKey).(map[int]bool)
+		if closed == nil {
+			closed = closedOpeners(reader.Source())
+			pc.Set(closedOpenersKey, closed)
+		}
+		if closed[segment.Stop] {
+			node.fence = fence
+			return node, parser.HasChildren
+		}
+		return node, parser.NoChildren
+	}
+
 	node := NewDirective(name)
+	node.setStart(segment.Start)
 	for _, f := range fields[1:] {
 		if k, v, ok := strings.Cut(f, "="); ok {
 			node.Options[strings.TrimSpace(k)] = strings.TrimSpace(v)
@@ -79,12 +190,14 @@ func (b *directiveParser) Open(parent gast.Node, reader text.Reader, pc parser.C
 }
 
 func (b *directiveParser) Continue(node gast.Node, reader text.Reader, pc parser.Context) parser.State {
-	if _, ok := node.(*Captioned); ok {
+	if fence := containerFence(node); fence > 0 {
 		// A container runs until a bare `:::` fence. The body has no per-line
 		// marker, so Continue | HasChildren tells goldmark to parse each body line
 		// as a child block (image paragraphs, a table, the caption).
+		// The fence closes the innermost open container only, so an outer
+		// container (or one holding a fenced code block) reads it as body.
 		line, _ := reader.PeekLine()
-		if isCloseFence(line) {
+		if n := closeFence(line); n >= fence && innermost(node, pc) {
 			reader.AdvanceToEOL() // consume the fence, leaving its newline
 			return parser.Close
 		}
@@ -99,17 +212,149 @@ func (b *directiveParser) CanInterruptParagraph() bool { return true }
 
 func (b *directiveParser) CanAcceptIndentedLine() bool { return false }
 
-// isCloseFence reports whether a line is a bare `:::` (three or more colons,
-// nothing else), the closing fence of a container directive.
-func isCloseFence(line []byte) bool {
+// containerFence returns the opening fence length of a container directive
+// node, or 0 for a leaf.
+func containerFence(node gast.Node) int {
+	switch n := node.(type) {
+	case *Captioned:
+		return n.fence
+	case *Callout:
+		return n.fence
+	case *Block:
+		return n.fence
+	case *Columns:
+		return n.fence
+	}
+	return 0
+}
+
+// innermost reports whether node is the deepest open container directive, with
+// no fenced code block open inside it.
+func innermost(node gast.Node, pc parser.Context) bool {
+	inside := false
+	for _, b := range pc.OpenedBlocks() {
+		if b.Node == node {
+			inside = true
+			continue
+		}
+		if inside && (containerFence(b.Node) > 0 || b.Node.Kind() == gast.KindFencedCodeBlock) {
+			return false
+		}
+	}
+	return true
+}
+
+// closedOpenersKey caches closedOpeners for the source being parsed, so a
+// document full of generic blocks is scanned once rather than once per block.
+var closedOpenersKey = parser.NewContextKey()
+
+// closedOpeners scans src once and returns the `:::name` container openers a
+// later bare fence closes, each named by the source offset just past its line
+// (the Stop of the opener's segment). Openers stack up; a bare fence of at
+// least as many colons as the innermost one closes it, and a shorter one is
+// body text. Fences inside a code block don't count, and blockquote markers and
+// indentation are ignored, so the scan is an approximation of the real parse
+// that errs towards treating a block as a container.
+func closedOpeners(src []byte) map[int]bool {
+	type opener struct{ stop, fence int }
+	var open []opener
+	closed := map[int]bool{}
+	var code byte // fence char of an open code block, 0 outside one
+	for pos := 0; pos < len(src); {
+		line := src[pos:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+			pos += i + 1
+		} else {
+			pos = len(src)
+		}
+		line = bytes.TrimLeft(line, " \t>")
+		if code != 0 {
+			if bytes.HasPrefix(line, []byte{code, code, code}) {
+				code = 0
+			}
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("```")) || bytes.HasPrefix(line, []byte("~~~")) {
+			code = line[0]
+			continue
+		}
+		if n := closeFence(line); n > 0 {
+			if last := len(open) - 1; last >= 0 && n >= open[last].fence {
+				closed[open[last].stop] = true
+				open = open[:last]
+			}
+			continue
+		}
+		if bytes.HasPrefix(line, []byte(":::")) {
+			rest := bytes.TrimLeft(line, ":")
+			fields := directiveFields(string(rest))
+			if len(fields) > 0 && !leafDirectives[fields[0]] {
+				open = append(open, opener{stop: pos, fence: len(line) - len(rest)})
+			}
+		}
+	}
+	return closed
+}
+
+// directiveFields splits the text after a directive's colons into words at
+// blanks. A double-quoted run, a whole word or the value of key="…", may hold
+// blanks and loses its quotes: `signature label="Signed by" lines=2` gives
+// signature, label=Signed by and lines=2.
+func directiveFields(s string) []string {
+	var fields []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && unicode.IsSpace(r):
+			if inWord {
+				fields = append(fields, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		fields = append(fields, word.String())
+	}
+	return fields
+}
+
+// closeFence returns the number of colons when a line is a bare `:::` (three or
+// more colons, nothing else), the closing fence of a container directive, and 0
+// otherwise.
+func closeFence(line []byte) int {
 	s := strings.TrimSpace(string(line))
 	if len(s) < 3 {
-		return false
+		return 0
 	}
 	for i := 0; i < len(s); i++ {
 		if s[i] != ':' {
-			return false
+			return 0
 		}
 	}
-	return true
+	return len(s)
+}
+
+// skipSpace returns the index of the first non-blank byte of line at or after i.
+func skipSpace(line []byte, i int) int {
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// skipWord returns the index just past the run of non-blank bytes at i.
+func skipWord(line []byte, i int) int {
+	for i < len(line) && !util.IsSpace(line[i]) {
+		i++
+	}
+	return i
 }
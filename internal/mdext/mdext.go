@@ -10,6 +10,7 @@ package mdext
 
 import (
 	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/locale"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer"
@@ -20,21 +21,42 @@ import (
 type Config struct {
 	References []document.Reference
 	Numbering  document.Numbering
-	// Labels maps a captioned variant ("figure"/"table") to its caption word,
-	// e.g. {"figure": "Abbildung", "table": "Tabelle"}. Empty entries fall back
-	// to the English defaults.
+	// Labels are the generated strings by locale key (see locale.Pack): the
+	// caption words ("figure"/"table"), the appendix prefix and the unresolved
+	// placeholder. internal/render passes the document language's pack with the
+	// frontmatter `labels` applied; missing entries fall back to English.
 	Labels map[string]string
+	// Lang is the document's language tag, which picks the smart-typography
+	// quotes and reference words (see locale.Pack).
+	Lang string
+	// Smart enables the smart-typography pass (see typography.go).
+	Smart bool
+	// StatsExclude names the parts left out of the word count (see stats.go
+	// and document.Stats).
+	StatsExclude []string
+	// Footnotes places `[^x]` footnotes at the page bottom or as endnotes (see
+	// notes.go).
+	Footnotes document.Footnotes
+	// Columns sets the main matter in that many columns (page.columns); 0 or 1
+	// leaves it in one.
+	Columns int
+	// TitlePage returns the HTML a `:::titlepage` directive emits: the theme's
+	// "titlepage" template, executed by internal/render. It is called only
+	// for a body that has one; nil emits an empty title page.
+	TitlePage func() (string, error)
+	// SourceMap labels each line of the markdown, by index, with the
+	// "file:line" its blocks carry as data-src (see source.go); nil leaves
+	// the attribute out.
+	SourceMap []string
 }
 
-// label returns the caption word for a variant ("Figure"/"Table" by default).
-func (c Config) label(variant string) string {
-	if v := c.Labels[variant]; v != "" {
+// label returns the generated string for a locale key, e.g. the caption word
+// for a variant ("Figure"/"Table" in English).
+func (c Config) label(key string) string {
+	if v := c.Labels[key]; v != "" {
 		return v
 	}
-	if variant == "table" {
-		return "Table"
-	}
-	return "Figure"
+	return locale.Get(locale.DefaultLang).Label(key)
 }
 
 type extender struct {
@@ -46,12 +68,21 @@ type extender struct {
 func New(cfg Config) goldmark.Extender { return &extender{cfg: cfg} }
 
 // Extend registers the directive block parser, the citation inline parser, the
-// numbering/collection transformer, and the node renderers.
+// numbering/collection transformer, the optional smart-typography pass, and the
+// node renderers. The typography pass runs first so the titles the numbering
+// transformer collects are already typeset; the footnote placement runs last,
+// after goldmark's footnote transformer (999) has numbered the notes, and the
+// source positions (when asked for) are attached once every block is in place.
 //
 // Priorities: the citation inline parser runs ahead of goldmark's link (200)
 // and footnote (101) parsers so it can claim `[@…`, while returning nil for
 // everything else so links and footnotes still work.
 func (e *extender) Extend(m goldmark.Markdown) {
+	if e.cfg.Smart {
+		m.Parser().AddOptions(parser.WithASTTransformers(
+			util.Prioritized(newTypographer(e.cfg), 90),
+		))
+	}
 	m.Parser().AddOptions(
 		parser.WithBlockParsers(
 			util.Prioritized(NewDirectiveParser(), 100),
@@ -61,9 +92,15 @@ func (e *extender) Extend(m goldmark.Markdown) {
 		),
 		parser.WithASTTransformers(
 			util.Prioritized(newTransformer(e.cfg), 100),
+			util.Prioritized(newNoteTransformer(e.cfg), 1000),
 		),
 	)
+	if e.cfg.SourceMap != nil {
+		m.Parser().AddOptions(parser.WithASTTransformers(
+			util.Prioritized(&sourceTransformer{lines: e.cfg.SourceMap}, 1001),
+		))
+	}
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
-		util.Prioritized(NewNodeRenderer(), 100),
+		util.Prioritized(NewNodeRenderer(e.cfg), 100),
 	))
 }
@@ -2,10 +2,12 @@ package mdext_test
 
 import (
 	"bytes"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/locale"
 	"github.com/hinkolas/mdoc/internal/mdext"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
@@ -162,10 +164,11 @@ func TestMatterRegions(t *testing.T) {
 		// main matter: decimal:
 		`<h1 id="einleitung"><span class="mdoc-secnum">1</span>`,
 		`<h2 id="aufbau"><span class="mdoc-secnum">1.1</span>`,
-		// appendix: lettered, with the chapter counter reset:
-		`<h1 id="diagramme"><span class="mdoc-secnum">A</span>`,
+		// appendix: lettered, with the chapter counter reset and the chapters
+		// carrying the appendix prefix:
+		`<h1 id="diagramme"><span class="mdoc-secnum" data-prefix="Appendix">A</span>`,
 		`<h2 id="detail"><span class="mdoc-secnum">A.1</span>`,
-		`<h1 id="software"><span class="mdoc-secnum">B</span>`,
+		`<h1 id="software"><span class="mdoc-secnum" data-prefix="Appendix">B</span>`,
 	)
 	// markers are consumed, not rendered as empty directives:
 	notAny(t, got, `:::frontmatter`, `mdoc-matter-front">\n</div>`)
@@ -219,7 +222,7 @@ func TestCoexistsWithLinksAndFootnotes(t *testing.T) {
 	wantAll(t, got,
 		`<a href="https://example.com">link</a>`,
 		`<a class="mdoc-cite" href="#mdoc-ref-k">[1]</a>`,
-		`role="doc-noteref"`, // footnote link still rendered by goldmark
+		`role="doc-noteref"`, // footnote still parsed by goldmark
 	)
 }
 
@@ -240,6 +243,26 @@ func TestTOCDepthOption(t *testing.T) {
 	notAny(t, got, `href="#two"`) // depth 1 excludes the h2
 }
 
+func TestHeadingsOf(t *testing.T) {
+	g := goldmark.New(
+		goldmark.WithExtensions(mdext.New(numbered())),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID(), parser.WithHeadingAttribute()),
+	)
+	ctx := parser.NewContext(parser.WithIDs(mdext.NewIDs()))
+	src := "# One\n\n## Two\n\n## Hidden {.notoc}\n\n# Three {.unnumbered}\n"
+	if err := g.Convert([]byte(src), &bytes.Buffer{}, parser.WithContext(ctx)); err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	want := []mdext.HeadingEntry{
+		{Level: 1, Number: "1", Title: "One", ID: "one"},
+		{Level: 2, Number: "1.1", Title: "Two", ID: "two"},
+		{Level: 1, Title: "Three", ID: "three"},
+	}
+	if got := mdext.HeadingsOf(ctx); !slices.Equal(got, want) {
+		t.Errorf("headings = %+v, want %+v", got, want)
+	}
+}
+
 func TestFigure(t *testing.T) {
 	got := render(t, numbered(), strings.Join([]string{
 		"# Kapitel",
@@ -434,6 +457,28 @@ func TestCustomLabels(t *testing.T) {
 	wantAll(t, got, `<span class="mdoc-fig-label">Abbildung 1.1</span>`)
 }
 
+func TestLocaleLabels(t *testing.T) {
+	cfg := numbered()
+	cfg.Labels = locale.Get("de").WithLabels(map[string]string{"unresolved": "??"}).Labels
+	got := render(t, cfg, strings.Join([]string{
+		":::appendix",
+		"# Daten",
+		"",
+		":::table",
+		"| a |",
+		"|---|",
+		"| 1 |",
+		"",
+		"Messwerte [#nope].",
+		":::",
+	}, "\n"))
+	wantAll(t, got,
+		`<span class="mdoc-secnum" data-prefix="Anhang">A</span>`,
+		`<span class="mdoc-tab-label">Tabelle A.1</span>`,
+		`<span class="mdoc-xref mdoc-xref-unresolved">??</span>`,
+	)
+}
+
 func TestCrossRefNumber(t *testing.T) {
 	got := render(t, numbered(), strings.Join([]string{
 		"# Kapitel",
@@ -493,3 +538,327 @@ func TestCaptionEntitiesDecodedInList(t *testing.T) {
 	wantAll(t, got, "<span class=\"mdoc-lof-text\">Spannung mit 50 Hz.</span>")
 	notAny(t, got, `&amp;nbsp;`)
 }
+
+func TestSmartTypography(t *testing.T) {
+	cfg := numbered()
+	cfg.Lang = "de"
+	cfg.Smart = true
+	cfg.Labels = locale.Get("de").Labels
+	got := render(t, cfg, strings.Join([]string{
+		":::toc",
+		"",
+		`# Das "Modell"`,
+		"",
+		`Er sagt "Hallo" und 's geht's, siehe Abb. [#fig-a] und S. 10-12.`,
+		"Bei 50 Hz und 3 % Last -- am 2026-03-01.",
+		"",
+		"Code `\"x\" 10-20` bleibt, $a-1 \"b\"$ auch, ebenso \\\"das\\\".",
+		"",
+		`Preise $5 "netto" und $10, 10-12 $.`,
+		"",
+		":::figure #fig-a",
+		"![](a.svg)",
+		"",
+		"Bild.",
+		":::",
+	}, "\n"))
+	wantAll(t, got,
+		`Das „Modell“</h1>`,
+		`<span class="mdoc-toc-text">Das „Modell“</span>`, // the TOC title is typeset too
+		"„Hallo“",
+		"geht’s",
+		"Abb. <a class=\"mdoc-xref\"",
+		"S. 10–12",
+		"50 Hz und 3 % Last – am 2026-03-01.",
+		`<code>&quot;x&quot; 10-20</code>`,
+		`$a-1 &quot;b&quot;$`,
+		`&quot;das&quot;.`,
+		"Preise $5 „netto“ und $10, 10–12 $.",
+		"Abbildung 1.1</span>",
+	)
+}
+
+func TestSmartTypographyOffByDefault(t *testing.T) {
+	got := render(t, mdext.Config{}, `He said "hi" on pages 10-12 -- at 50 Hz.`)
+	wantAll(t, got, `He said &quot;hi&quot; on pages 10-12 -- at 50 Hz.`)
+}
+
+// stats converts md and returns the counts the transformer recorded.
+func stats(t *testing.T, cfg mdext.Config, md string) mdext.Stats {
+	t.Helper()
+	g := goldmark.New(goldmark.WithExtensions(extension.GFM, extension.Footnote, mdext.New(cfg)))
+	ctx := parser.NewContext()
+	if err := g.Convert([]byte(md), &bytes.Buffer{}, parser.WithContext(ctx)); err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	return mdext.StatsOf(ctx)
+}
+
+func TestStats(t *testing.T) {
+	src := strings.Join([]string{
+		"# Two words",
+		"",
+		"One `code` and $x + y$ here, see [#fig-a] [@k].",
+		"",
+		"```",
+		"three code words",
+		"```",
+		"",
+		":::figure #fig-a",
+		"![](a.svg)",
+		"",
+		"Caption text.",
+		":::",
+		"",
+		":::bibliography",
+	}, "\n")
+	refs := []document.Reference{{Key: "k", Text: "Entry one."}}
+	cases := []struct {
+		exclude []string
+		words   int
+	}{
+		// 2 heading + "One and here, see 0 [0]" (6) + 2 caption + 2 bibliography
+		{[]string{"code", "math"}, 12},
+		{nil, 12 + 1 + 3 + 2}, // + code span, code block, x and y ("+" is no word)
+		{[]string{"code", "math", "captions", "bibliography"}, 8},
+	}
+	for _, c := range cases {
+		got := stats(t, mdext.Config{References: refs, StatsExclude: c.exclude}, src)
+		if got.Words != c.words {
+			t.Errorf("exclude %v: words = %d, want %d", c.exclude, got.Words, c.words)
+		}
+	}
+
+	// Prices are no math: both dollar signs are literal.
+	if got := stats(t, mdext.Config{StatsExclude: []string{"math"}}, "It costs $5 and also $10 today."); got.Words != 7 {
+		t.Errorf("prices: words = %d, want 7", got.Words)
+	}
+
+	got := stats(t, mdext.Config{}, "Hello  wide\nworld.")
+	want := mdext.Stats{Words: 3, Characters: 17, CharactersNoSpaces: 15, ReadingMinutes: 1}
+	if got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestPageFootnotes(t *testing.T) {
+	cfg := mdext.Config{Footnotes: document.Footnotes{Mode: "page"}}
+	got := render(t, cfg, strings.Join([]string{
+		"Text[^a] and more[^b], again[^a].",
+		"",
+		"[^a]: First *note*.",
+		"",
+		"    Second paragraph.",
+		"[^b]: Other.",
+	}, "\n"))
+	wantAll(t, got,
+		`Text<span class="mdoc-footnote" id="mdoc-fn-1">First <em>note</em>. Second paragraph.</span>`,
+		`more<span class="mdoc-footnote" id="mdoc-fn-2">Other.</span>`,
+		`again<a class="mdoc-noteref" href="#mdoc-fn-1"></a>.`,
+	)
+	notAny(t, got, `class="footnotes"`, "footnote-backref")
+}
+
+func TestEndnotes(t *testing.T) {
+	cfg := mdext.Config{Footnotes: document.Footnotes{Mode: "endnotes"}}
+	got := render(t, cfg, strings.Join([]string{
+		"Text[^a].",
+		"",
+		"[^a]: The note.",
+		"",
+		"## Notes",
+		"",
+		":::endnotes",
+		"",
+		"After.",
+	}, "\n"))
+	wantAll(t, got, `role="doc-noteref"`)
+	notes, after := strings.Index(got, `class="footnotes"`), strings.Index(got, "<p>After.</p>")
+	if notes < 0 || notes < strings.Index(got, "<h2") || notes > after {
+		t.Errorf("expected the endnotes between the heading and the last paragraph:\n%s", got)
+	}
+
+	// Without the directive they stay at the end of the body. Endnotes are
+	// the default: page footnotes need a theme that floats them.
+	for _, cfg := range []mdext.Config{cfg, {}} {
+		got = render(t, cfg, "Text[^a].\n\n[^a]: The note.\n\nAfter.")
+		if strings.Index(got, `class="footnotes"`) < strings.Index(got, "<p>After.</p>") {
+			t.Errorf("mode %q: expected the endnotes at the end:\n%s", cfg.Footnotes.Mode, got)
+		}
+	}
+}
+
+func TestSidenotes(t *testing.T) {
+	got := render(t, mdext.Config{}, strings.Join([]string{
+		"A claim[>see **this** and [a link](https://x.org) with `]`] and [>{-} a margin *note*].",
+		"",
+		"Later[>second].",
+		"",
+		"Unclosed [>note *here*.",
+	}, "\n"))
+	wantAll(t, got,
+		`claim<span class="mdoc-sidenote" data-num="1"><span class="mdoc-footnote mdoc-sidenote-text" data-num="1">see <strong>this</strong> and <a href="https://x.org">a link</a> with <code>]</code></span></span>`,
+		`and <span class="mdoc-sidenote"><span class="mdoc-footnote mdoc-sidenote-text">a margin <em>note</em></span></span>.`,
+		`data-num="2">second</span>`,
+		`Unclosed [&gt;note <em>here</em>.`,
+	)
+}
+
+func TestSidenoteWithFootnoteRefs(t *testing.T) {
+	got := render(t, mdext.Config{}, strings.Join([]string{
+		"A claim[>see [^nope] and [^fn] here] after.",
+		"",
+		"[^fn]: Defined.",
+	}, "\n"))
+	wantAll(t, got,
+		`<span class="mdoc-footnote mdoc-sidenote-text" data-num="1">see [^nope] and <sup`,
+		` here</span></span> after.`,
+	)
+}
+
+func TestCallouts(t *testing.T) {
+	cfg := numbered()
+	cfg.Labels = locale.Get("de").Labels
+	got := render(t, cfg, strings.Join([]string{
+		":::warning #gap Mind *the* gap",
+		"Body **text**.",
+		"",
+		"- a list",
+		":::",
+		"",
+		"::::note",
+		"Outer.",
+		"",
+		":::figure",
+		"![](a.svg)",
+		"",
+		"Inner.",
+		":::",
+		"",
+		"Still outer.",
+		"::::",
+	}, "\n"))
+	wantAll(t, got,
+		"<aside class=\"mdoc-callout mdoc-callout-warning\" id=\"gap\">\n<p class=\"mdoc-callout-title\">Mind <em>the</em> gap</p>\n<p>Body <strong>text</strong>.</p>\n<ul>",
+		"<aside class=\"mdoc-callout mdoc-callout-note\">\n<p class=\"mdoc-callout-title\">Hinweis</p>\n<p>Outer.</p>\n<figure",
+		"Inner.</figcaption>\n</figure>\n<p>Still outer.</p>\n</aside>",
+	)
+}
+
+func TestGitHubAlerts(t *testing.T) {
+	got := render(t, mdext.Config{}, strings.Join([]string{
+		"> [!TIP]",
+		"> Alert *text*",
+		"> more.",
+		"",
+		"> [!caution]",
+		">",
+		"> Own paragraph.",
+		"",
+		"> [!NOPE]",
+		"> A plain quote.",
+	}, "\n"))
+	wantAll(t, got,
+		"<aside class=\"mdoc-callout mdoc-callout-tip\">\n<p class=\"mdoc-callout-title\">Tip</p>\n<p>Alert <em>text</em>\nmore.</p>\n</aside>",
+		"<aside class=\"mdoc-callout mdoc-callout-caution\">\n<p class=\"mdoc-callout-title\">Caution</p>\n<p>Own paragraph.</p>\n</aside>",
+		"<blockquote>\n<p>[!NOPE]",
+	)
+}
+
+func TestGenericBlocks(t *testing.T) {
+	got := render(t, mdext.Config{}, strings.Join([]string{
+		":::abstract #abs lang=en Width=2",
+		"Some *text*.",
+		"",
+		":::quote-box",
+		"Nested.",
+		":::",
+		"",
+		"```",
+		":::",
+		"```",
+		":::",
+		"",
+		":::signature lines=\"2\" label=\"Signed by\"",
+		"",
+		"After.",
+	}, "\n"))
+	wantAll(t, got,
+		"<div class=\"mdoc-block mdoc-block-abstract\" id=\"abs\" data-lang=\"en\" data-width=\"2\">\n<p>Some <em>text</em>.</p>\n<div class=\"mdoc-block mdoc-block-quote-box\">\n<p>Nested.</p>\n</div>\n<pre><code>:::\n</code></pre>\n</div>",
+		"<div class=\"mdoc-block mdoc-block-signature\" data-label=\"Signed by\" data-lines=\"2\"></div>\n<p>After.</p>",
+	)
+}
+
+func TestColumns(t *testing.T) {
+	got := render(t, mdext.Config{}, strings.Join([]string{
+		":::columns n=3 gap=8mm",
+		"Left.",
+		"",
+		":::column-break",
+		"",
+		"Right.",
+		":::",
+		"",
+		":::columns",
+		"Two.",
+		":::",
+	}, "\n"))
+	wantAll(t, got,
+		"<div class=\"mdoc-columns\" style=\"column-count: 3; column-gap: 8mm\">\n<p>Left.</p>\n<div class=\"mdoc-column-break\"></div>\n<p>Right.</p>\n</div>",
+		"<div class=\"mdoc-columns\" style=\"column-count: 2\">\n<p>Two.</p>\n</div>",
+	)
+
+	got = render(t, mdext.Config{Columns: 2}, "# Title\n\nBody.\n")
+	if !strings.HasPrefix(got, "<div class=\"mdoc-columns\" style=\"column-count: 2\">\n<h1") ||
+		!strings.HasSuffix(got, "<p>Body.</p>\n</div>\n") {
+		t.Fatalf("page.columns should wrap the body:\n%s", got)
+	}
+
+	got = render(t, mdext.Config{Columns: 2}, strings.Join([]string{
+		":::toc", "", ":::frontmatter", "Preface.", "", ":::mainmatter", "# One", "", ":::page", "", "Two.", "", ":::appendix", "Extra.",
+	}, "\n"))
+	wantAll(t, got,
+		"<div class=\"mdoc-matter-front\">\n<p>Preface.</p>\n</div>",
+		"<div class=\"mdoc-matter-main\">\n<div class=\"mdoc-columns\" style=\"column-count: 2\">\n<h1",
+		"</h1>\n</div>\n<div class=\"mdoc-pagebreak\"></div>\n",
+		"<div class=\"mdoc-columns\" style=\"column-count: 2\">\n<p>Two.</p>\n</div>\n</div>",
+		"<p>Extra.</p>",
+	)
+	if strings.Count(got, "mdoc-columns") != 2 || strings.Index(got, "mdoc-columns") < strings.Index(got, "mdoc-matter-main") {
+		t.Errorf("page.columns should wrap only the main matter, around the page break:\n%s", got)
+	}
+}
+
+func TestTitlePage(t *testing.T) {
+	calls := 0
+	cfg := mdext.Config{TitlePage: func() (string, error) {
+		calls++
+		return "<div>Cover</div>", nil
+	}}
+	got := render(t, cfg, ":::titlepage\n\n# One\n")
+	want := "<section class=\"mdoc-titlepage mdoc-page-cover\">\n<div>Cover</div>\n</section>\n<h1"
+	if !strings.HasPrefix(got, want) {
+		t.Fatalf("got:\n%s\nwant prefix:\n%s", got, want)
+	}
+
+	calls = 0
+	render(t, cfg, "# One\n")
+	if calls != 0 {
+		t.Errorf("the title page was rendered %d times for a body without :::titlepage", calls)
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	src := "# Title\n\nText.\n\n- item\n\n:::note\nInside.\n:::\n"
+	got := render(t, mdext.Config{SourceMap: []string{"a.md:4", "", "a.md:6", "", "b.md:1", "", "b.md:3", "b.md:4", "b.md:5"}}, src)
+	wantAll(t, got,
+		`<h1 id="title" data-src="a.md:4">`,
+		`<p data-src="a.md:6">Text.</p>`,
+		`<ul data-src="b.md:1">`+"\n"+`<li data-src="b.md:1">item</li>`,
+		`<aside class="mdoc-callout mdoc-callout-note" data-src="b.md:3">`,
+		`<p data-src="b.md:4">Inside.</p>`,
+	)
+	if got := render(t, mdext.Config{}, src); strings.Contains(got, "data-src") {
+		t.Errorf("data-src without a source map:\n%s", got)
+	}
+}
@@ -0,0 +1,137 @@
+package mdext
+
+import (
+	"strconv"
+
+	gast "github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// notes.go places goldmark's `[^x]` footnotes (see document.Footnotes) and
+// numbers `[>note]` sidenotes. It runs after goldmark's own footnote
+// transformer, which numbers the footnotes by first reference and collects them
+// into one list at the end of the body:
+//
+//   - in "page" mode each note moves to its first reference as a Note, which
+//     the theme floats to the bottom of that page, and the list is dropped;
+//   - in "endnotes" mode the list stays as goldmark renders it, moved to the
+//     first `:::endnotes` directive when there is one.
+//
+// Sidenotes are numbered by their own count, in document order.
+type noteTransformer struct {
+	mode string
+}
+
+func newNoteTransformer(cfg Config) *noteTransformer {
+	return &noteTransformer{mode: cfg.Footnotes.Placement()}
+}
+
+var sidenotesKey = parser.NewContextKey()
+
+// HasSidenotes reports whether the document converted with pc has sidenotes, so
+// a theme can make room for them in the margin.
+func HasSidenotes(pc parser.Context) bool {
+	has, _ := pc.Get(sidenotesKey).(bool)
+	return has
+}
+
+func (t *noteTransformer) Transform(doc *gast.Document, _ text.Reader, pc parser.Context) {
+	var list *east.FootnoteList
+	var links []*east.FootnoteLink
+	var endnotes *Directive
+	sidenotes := 0
+	pc.Set(sidenotesKey, false)
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		switch v := n.(type) {
+		case *Sidenote:
+			pc.Set(sidenotesKey, true)
+			if v.Numbered {
+				sidenotes++
+				v.Number = sidenotes
+			}
+		case *east.FootnoteList:
+			list = v
+			return gast.WalkSkipChildren, nil
+		case *east.FootnoteLink:
+			links = append(links, v)
+		case *Directive:
+			if v.Name == "endnotes" && endnotes == nil {
+				endnotes = v
+			}
+		}
+		return gast.WalkContinue, nil
+	})
+	if list == nil {
+		return
+	}
+
+	if t.mode == "endnotes" {
+		if endnotes != nil {
+			list.Parent().RemoveChild(list.Parent(), list)
+			endnotes.Parent().ReplaceChild(endnotes.Parent(), endnotes, list)
+		}
+		return
+	}
+
+	byIndex := map[int]*east.Footnote{}
+	for c := list.FirstChild(); c != nil; c = c.NextSibling() {
+		if fn, ok := c.(*east.Footnote); ok {
+			byIndex[fn.Index] = fn
+		}
+	}
+	set := map[int]bool{}
+	for _, l := range links {
+		fn := byIndex[l.Index]
+		if fn == nil {
+			continue
+		}
+		id := noteID(l.Index)
+		parent := l.Parent()
+		if set[l.Index] {
+			parent.ReplaceChild(parent, l, NewNoteRef(id))
+			continue
+		}
+		set[l.Index] = true
+		note := NewNote(id)
+		fillNote(note, fn)
+		parent.ReplaceChild(parent, l, note)
+	}
+	list.Parent().RemoveChild(list.Parent(), list)
+}
+
+// fillNote moves a footnote's content into note. Paragraphs are unwrapped into
+// their inlines, joined by a space, so the note stays a single inline span;
+// goldmark's back-links are dropped, there is no list to link back from.
+func fillNote(note *Note, fn *east.Footnote) {
+	first := true
+	for c := fn.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		switch c.(type) {
+		case *east.FootnoteBacklink:
+		case *gast.Paragraph:
+			if !first {
+				note.AppendChild(note, gast.NewString([]byte(" ")))
+			}
+			for ch := c.FirstChild(); ch != nil; {
+				chNext := ch.NextSibling()
+				if _, ok := ch.(*east.FootnoteBacklink); !ok {
+					note.AppendChild(note, ch) // re-parents (detaches from c)
+				}
+				ch = chNext
+			}
+			first = false
+		default:
+			note.AppendChild(note, c)
+			first = false
+		}
+		c = next
+	}
+}
+
+// noteID is the element id of the footnote numbered index.
+func noteID(index int) string { return "mdoc-fn-" + strconv.Itoa(index) }
@@ -1,21 +1,29 @@
 package mdext
 
 import (
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 
 	gast "github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
 	"github.com/yuin/goldmark/util"
 )
 
 // nodeRenderer emits the stable mdoc-* class contract for the custom nodes.
 // Page numbers are deliberately not emitted: a theme adds them to TOC entries
 // via paged.js `target-counter(attr(href url), page)`.
-type nodeRenderer struct{}
+type nodeRenderer struct {
+	unresolved string                 // placeholder for a citation or cross-reference target that doesn't exist
+	titlePage  func() (string, error) // HTML of a :::titlepage
+}
 
 // NewNodeRenderer returns the renderer for Directive, Citation and SecNum nodes.
-func NewNodeRenderer() renderer.NodeRenderer { return &nodeRenderer{} }
+func NewNodeRenderer(cfg Config) renderer.NodeRenderer {
+	return &nodeRenderer{unresolved: cfg.label("unresolved"), titlePage: cfg.TitlePage}
+}
 
 // RegisterFuncs implements renderer.NodeRenderer.
 func (r *nodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
@@ -27,6 +35,13 @@ func (r *nodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
 	reg.Register(KindCaption, r.renderCaption)
 	reg.Register(KindCaptionLabel, r.renderCaptionLabel)
 	reg.Register(KindXref, r.renderXref)
+	reg.Register(KindNote, r.renderNote)
+	reg.Register(KindNoteRef, r.renderNoteRef)
+	reg.Register(KindSidenote, r.renderSidenote)
+	reg.Register(KindCallout, r.renderCallout)
+	reg.Register(KindCalloutTitle, r.renderCalloutTitle)
+	reg.Register(KindBlock, r.renderBlock)
+	reg.Register(KindColumns, r.renderColumns)
 }
 
 func (r *nodeRenderer) renderDirective(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
@@ -51,6 +66,20 @@ func (r *nodeRenderer) renderDirective(w util.BufWriter, _ []byte, n gast.Node,
 			_, _ = w.Write(util.EscapeHTML([]byte(d.Arg)))
 		}
 		_, _ = w.WriteString("\"></div>\n")
+	case "titlepage":
+		// The cover sits on the theme's `cover` named page (.mdoc-page-cover).
+		var page string
+		if r.titlePage != nil {
+			var err error
+			if page, err = r.titlePage(); err != nil {
+				return gast.WalkStop, err
+			}
+		}
+		_, _ = w.WriteString("<section class=\"mdoc-titlepage mdoc-page-cover\">\n")
+		_, _ = w.WriteString(page)
+		_, _ = w.WriteString("\n</section>\n")
+	case "column-break":
+		_, _ = w.WriteString("<div class=\"mdoc-column-break\"></div>\n")
 	}
 	return gast.WalkSkipChildren, nil
 }
@@ -67,7 +96,9 @@ func (r *nodeRenderer) renderMatter(w util.BufWriter, _ []byte, n gast.Node, ent
 }
 
 func (r *nodeRenderer) renderTOC(w util.BufWriter, d *Directive) {
-	_, _ = w.WriteString("<nav class=\"mdoc-toc\">\n")
+	_, _ = w.WriteString(`<nav class="mdoc-toc"`)
+	html.RenderAttributes(w, d, nil)
+	_, _ = w.WriteString(">\n")
 	for _, h := range d.Headings {
 		_, _ = w.WriteString(`<a class="mdoc-toc-entry" data-level="`)
 		_, _ = w.WriteString(strconv.Itoa(h.Level))
@@ -87,7 +118,9 @@ func (r *nodeRenderer) renderTOC(w util.BufWriter, d *Directive) {
 }
 
 func (r *nodeRenderer) renderBib(w util.BufWriter, d *Directive) {
-	_, _ = w.WriteString("<ol class=\"mdoc-bib\">\n")
+	_, _ = w.WriteString(`<ol class="mdoc-bib"`)
+	html.RenderAttributes(w, d, nil)
+	_, _ = w.WriteString(">\n")
 	for _, e := range d.Bib {
 		_, _ = w.WriteString(`<li class="mdoc-bib-entry" id="`)
 		_, _ = w.WriteString(refID(e.Key))
@@ -107,7 +140,9 @@ func (r *nodeRenderer) renderBib(w util.BufWriter, d *Directive) {
 // renderCaptionList emits a `:::lof` / `:::lot` list (class "lof" or "lot").
 // Page numbers are left to the theme's target-counter, like the TOC.
 func (r *nodeRenderer) renderCaptionList(w util.BufWriter, d *Directive, class string) {
-	_, _ = w.WriteString(`<nav class="mdoc-` + class + "\">\n")
+	_, _ = w.WriteString(`<nav class="mdoc-` + class + `"`)
+	html.RenderAttributes(w, d, nil)
+	_, _ = w.WriteString(">\n")
 	for _, e := range d.Entries {
 		_, _ = w.WriteString(`<a class="mdoc-` + class + `-entry" href="#`)
 		_, _ = w.Write(util.EscapeHTML([]byte(e.ID)))
@@ -135,16 +170,122 @@ func (r *nodeRenderer) renderCaptioned(w util.BufWriter, _ []byte, n gast.Node,
 		}
 		_, _ = w.WriteString(`<figure class="` + class + `" id="`)
 		_, _ = w.Write(util.EscapeHTML([]byte(c.ID)))
-		_, _ = w.WriteString("\">\n")
+		_, _ = w.WriteString(`"`)
+		html.RenderAttributes(w, c, nil)
+		_, _ = w.WriteString(">\n")
 	} else {
 		_, _ = w.WriteString("</figure>\n")
 	}
 	return gast.WalkContinue, nil
 }
 
+// renderCallout wraps a callout in an <aside>; its first child is the title.
+func (r *nodeRenderer) renderCallout(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	c := n.(*Callout)
+	if !entering {
+		_, _ = w.WriteString("</aside>\n")
+		return gast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(`<aside class="mdoc-callout mdoc-callout-` + c.Variant + `"`)
+	if c.ID != "" {
+		_, _ = w.WriteString(` id="`)
+		_, _ = w.Write(util.EscapeHTML([]byte(c.ID)))
+		_, _ = w.WriteString(`"`)
+	}
+	html.RenderAttributes(w, c, nil)
+	_, _ = w.WriteString(">\n")
+	return gast.WalkContinue, nil
+}
+
+// renderColumns sets the count (and gap) inline, since a theme can't read a
+// number out of an attribute into column-count.
+func (r *nodeRenderer) renderColumns(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	c := n.(*Columns)
+	if !entering {
+		_, _ = w.WriteString("</div>\n")
+		return gast.WalkContinue, nil
+	}
+	style := "column-count: " + strconv.Itoa(c.Count)
+	if c.Gap != "" {
+		style += "; column-gap: " + c.Gap
+	}
+	_, _ = w.WriteString(`<div class="mdoc-columns"`)
+	writeAttr(w, "style", style)
+	html.RenderAttributes(w, c, nil)
+	_, _ = w.WriteString(">\n")
+	return gast.WalkContinue, nil
+}
+
+// renderBlock emits a theme-defined block as a div: the name becomes a class
+// and the options data-* attributes (`:::signature lines=2` →
+// `<div class="mdoc-block mdoc-block-signature" data-lines="2">`).
+func (r *nodeRenderer) renderBlock(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	b := n.(*Block)
+	if !entering {
+		_, _ = w.WriteString("</div>\n")
+		return gast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(`<div class="mdoc-block mdoc-block-`)
+	_, _ = w.Write(util.EscapeHTML([]byte(b.Name)))
+	_, _ = w.WriteString(`"`)
+	if b.ID != "" {
+		writeAttr(w, "id", b.ID)
+	}
+	if b.Arg != "" {
+		writeAttr(w, "data-arg", b.Arg)
+	}
+	data := map[string]string{}
+	for k, v := range b.Options {
+		if name := dataName(k); name != "" {
+			data["data-"+name] = v
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(data)) {
+		writeAttr(w, name, data[name])
+	}
+	html.RenderAttributes(w, b, nil)
+	_, _ = w.WriteString(">")
+	if b.fence > 0 {
+		_, _ = w.WriteString("\n")
+	}
+	return gast.WalkContinue, nil
+}
+
+// writeAttr writes ` name="value"` with the value escaped.
+func writeAttr(w util.BufWriter, name, value string) {
+	_, _ = w.WriteString(" " + name + `="`)
+	_, _ = w.Write(util.EscapeHTML([]byte(value)))
+	_, _ = w.WriteString(`"`)
+}
+
+// dataName lowercases an option key and drops anything a data-* attribute name
+// can't hold.
+func dataName(key string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(key) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func (r *nodeRenderer) renderCalloutTitle(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<p class="mdoc-callout-title"`)
+		html.RenderAttributes(w, n, nil)
+		_, _ = w.WriteString(">")
+	} else {
+		_, _ = w.WriteString("</p>\n")
+	}
+	return gast.WalkContinue, nil
+}
+
 func (r *nodeRenderer) renderCaption(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
 	if entering {
-		_, _ = w.WriteString(`<figcaption class="mdoc-figcaption">`)
+		_, _ = w.WriteString(`<figcaption class="mdoc-figcaption"`)
+		html.RenderAttributes(w, n, nil)
+		_, _ = w.WriteString(">")
 	} else {
 		_, _ = w.WriteString("</figcaption>\n")
 	}
@@ -173,7 +314,9 @@ func (r *nodeRenderer) renderXref(w util.BufWriter, _ []byte, n gast.Node, enter
 	x := n.(*Xref)
 	switch {
 	case !x.Resolved:
-		_, _ = w.WriteString(`<span class="mdoc-xref mdoc-xref-unresolved">[?]</span>`)
+		_, _ = w.WriteString(`<span class="mdoc-xref mdoc-xref-unresolved">`)
+		_, _ = w.Write(util.EscapeHTML([]byte(r.unresolved)))
+		_, _ = w.WriteString(`</span>`)
 	case x.Mode == "page":
 		_, _ = w.WriteString(`<a class="mdoc-pageref" href="#`)
 		_, _ = w.Write(util.EscapeHTML([]byte(x.ID)))
@@ -188,6 +331,48 @@ func (r *nodeRenderer) renderXref(w util.BufWriter, _ []byte, n gast.Node, enter
 	return gast.WalkSkipChildren, nil
 }
 
+// renderNote emits a page-bottom footnote as an inline span; the theme's
+// `float: footnote` moves it out of the text and numbers it.
+func (r *nodeRenderer) renderNote(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<span class="mdoc-footnote" id="`)
+		_, _ = w.WriteString(n.(*Note).ID)
+		_, _ = w.WriteString(`">`)
+	} else {
+		_, _ = w.WriteString(`</span>`)
+	}
+	return gast.WalkContinue, nil
+}
+
+// renderNoteRef emits a repeated footnote reference as an empty link the theme
+// fills with the note's number via target-counter.
+func (r *nodeRenderer) renderNoteRef(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<a class="mdoc-noteref" href="#`)
+		_, _ = w.WriteString(n.(*NoteRef).ID)
+		_, _ = w.WriteString(`"></a>`)
+	}
+	return gast.WalkSkipChildren, nil
+}
+
+// renderSidenote emits a margin note as a `mdoc-sidenote` span (the call,
+// numbered via data-num) around the note text. The text also carries the
+// footnote class, so a theme without sidenote styles sets it as a footnote.
+func (r *nodeRenderer) renderSidenote(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	sn := n.(*Sidenote)
+	num := ""
+	if sn.Numbered {
+		num = ` data-num="` + strconv.Itoa(sn.Number) + `"`
+	}
+	if entering {
+		_, _ = w.WriteString(`<span class="mdoc-sidenote"` + num + `>`)
+		_, _ = w.WriteString(`<span class="mdoc-footnote mdoc-sidenote-text"` + num + `>`)
+	} else {
+		_, _ = w.WriteString(`</span></span>`)
+	}
+	return gast.WalkContinue, nil
+}
+
 func (r *nodeRenderer) renderCitation(w util.BufWriter, _ []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
 	if !entering {
 		return gast.WalkContinue, nil
@@ -200,7 +385,9 @@ func (r *nodeRenderer) renderCitation(w util.BufWriter, _ []byte, n gast.Node, e
 		_, _ = w.WriteString(strconv.Itoa(c.Number))
 		_, _ = w.WriteString(`]</a>`)
 	} else {
-		_, _ = w.WriteString(`<span class="mdoc-cite mdoc-cite-unresolved">[?]</span>`)
+		_, _ = w.WriteString(`<span class="mdoc-cite mdoc-cite-unresolved">`)
+		_, _ = w.Write(util.EscapeHTML([]byte(r.unresolved)))
+		_, _ = w.WriteString(`</span>`)
 	}
 	return gast.WalkSkipChildren, nil
 }
@@ -209,8 +396,15 @@ func (r *nodeRenderer) renderSecNum(w util.BufWriter, _ []byte, n gast.Node, ent
 	if !entering {
 		return gast.WalkContinue, nil
 	}
-	_, _ = w.WriteString(`<span class="mdoc-secnum">`)
-	_, _ = w.Write(util.EscapeHTML([]byte(n.(*SecNum).Num)))
+	sn := n.(*SecNum)
+	_, _ = w.WriteString(`<span class="mdoc-secnum"`)
+	if sn.Prefix != "" {
+		_, _ = w.WriteString(` data-prefix="`)
+		_, _ = w.Write(util.EscapeHTML([]byte(sn.Prefix)))
+		_, _ = w.WriteString(`"`)
+	}
+	_, _ = w.WriteString(`>`)
+	_, _ = w.Write(util.EscapeHTML([]byte(sn.Num)))
 	_, _ = w.WriteString(`</span> `)
 	return gast.WalkSkipChildren, nil
 }
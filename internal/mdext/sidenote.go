@@ -0,0 +1,96 @@
+package mdext
+
+import (
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// sidenote.go parses `[>note text]` margin notes. A note's text is ordinary
+// inline markdown, so like a link label it is parsed in place: `[>` opens a
+// Sidenote, the inlines that follow are parsed as usual, and the matching `]`
+// moves them into it. `[>{-} text]` is an unnumbered note (the Tufte
+// convention). Brackets the link parser opens inside a note are counted so a
+// link's `]` doesn't close the note; a note left open at the end of its
+// paragraph reverts to literal text.
+
+var sidenoteKey = parser.NewContextKey()
+
+// sidenoteState is the note open in the current paragraph.
+type sidenoteState struct {
+	open   *Sidenote
+	bottom gast.Node // last delimiter before the note, see parser.ProcessDelimiters
+	depth  int       // brackets opened inside the note and not yet closed
+}
+
+func sidenoteOf(pc parser.Context) *sidenoteState {
+	st, _ := pc.Get(sidenoteKey).(*sidenoteState)
+	return st
+}
+
+// openSidenote parses the `[>` or `[>{-} ` that opens a note.
+func openSidenote(line []byte, segment text.Segment, block text.Reader, pc parser.Context) gast.Node {
+	n := 2
+	numbered := true
+	if len(line) >= 5 && string(line[2:5]) == "{-}" {
+		numbered = false
+		n = 5
+		if len(line) > n && line[n] == ' ' {
+			n++
+		}
+	}
+	if len(line) <= n || line[n] == ']' || line[n] == '\n' {
+		return nil
+	}
+	block.Advance(n)
+	note := NewSidenote(numbered)
+	note.open = text.NewSegment(segment.Start, segment.Start+n)
+	pc.Set(sidenoteKey, &sidenoteState{open: note, bottom: pc.LastDelimiter()})
+	return note
+}
+
+// closeSidenote handles a `]`: when it closes the open note, the inlines parsed
+// since the note opened become its children.
+func closeSidenote(parent gast.Node, block text.Reader, pc parser.Context) gast.Node {
+	st := sidenoteOf(pc)
+	if st == nil || st.open.Parent() != parent {
+		return nil
+	}
+	if st.depth > 0 {
+		st.depth-- // a link label's `]`
+		return nil
+	}
+	block.Advance(1)
+	pc.Set(sidenoteKey, nil)
+	parser.ProcessDelimiters(st.bottom, pc)
+	note := st.open
+	for c := note.NextSibling(); c != nil; {
+		next := c.NextSibling()
+		note.AppendChild(note, c) // re-parents (detaches from parent)
+		c = next
+	}
+	// Returned nodes are appended to the paragraph, which puts the note back
+	// where it was: nothing follows it now.
+	parent.RemoveChild(parent, note)
+	return note
+}
+
+// countBracket notes a `[` left to the link parser inside an open note.
+func countBracket(pc parser.Context) {
+	if st := sidenoteOf(pc); st != nil {
+		st.depth++
+	}
+}
+
+// CloseBlock implements parser.CloseBlocker: a note still open at the end of
+// its paragraph was never closed, so its opener is literal text.
+func (s *citationParser) CloseBlock(parent gast.Node, block text.Reader, pc parser.Context) {
+	st := sidenoteOf(pc)
+	if st == nil {
+		return
+	}
+	pc.Set(sidenoteKey, nil)
+	if p := st.open.Parent(); p != nil {
+		p.ReplaceChild(p, st.open, gast.NewTextSegment(st.open.open))
+	}
+}
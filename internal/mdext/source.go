@@ -0,0 +1,66 @@
+package mdext
+
+import (
+	"sort"
+
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// sourceTransformer gives every block a data-src attribute naming the file and
+// line it was written at, so the preview can open the source of a clicked
+// block. lines labels each markdown line by index (see Config.SourceMap).
+// Blocks whose renderer writes no attributes, such as code blocks, are found
+// through the nearest labelled element instead.
+type sourceTransformer struct {
+	lines []string
+}
+
+func (t *sourceTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	starts := []int{0}
+	for i, c := range source {
+		if c == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering || n.Type() != gast.TypeBlock || n.Kind() == gast.KindDocument {
+			return gast.WalkContinue, nil
+		}
+		if pos, ok := blockStart(n); ok {
+			line := sort.SearchInts(starts, pos+1) - 1
+			if line < len(t.lines) && t.lines[line] != "" {
+				n.SetAttributeString("data-src", t.lines[line])
+			}
+		}
+		return gast.WalkContinue, nil
+	})
+}
+
+// blockStart returns the source offset a block starts at: a directive's
+// opening line, a block's first line, or the first line of its first
+// positioned child block for a container.
+func blockStart(n gast.Node) (int, bool) {
+	if o, ok := n.(interface{ sourceStart() (int, bool) }); ok {
+		if pos, ok := o.sourceStart(); ok {
+			return pos, true
+		}
+	}
+	if f, ok := n.(*gast.FencedCodeBlock); ok && f.Info != nil {
+		return f.Info.Segment.Start, true
+	}
+	if n.Lines().Len() > 0 {
+		return n.Lines().At(0).Start, true
+	}
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if c.Type() != gast.TypeBlock {
+			continue
+		}
+		if pos, ok := blockStart(c); ok {
+			return pos, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,182 @@
+package mdext
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	gast "github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+)
+
+// stats.go counts the words and characters of the body for `{{.Stats}}` and
+// `mdoc stats`, the numbers a submission's word limit is checked against. The
+// count covers the text a reader reads: headings, paragraphs, lists, tables,
+// and — unless excluded (see document.Stats) — code, math, captions, the
+// bibliography, and footnotes (sidenotes included). Generated lists (TOC, list
+// of figures/tables) and raw HTML never count.
+
+// wordsPerMinute is the reading speed behind Stats.ReadingMinutes.
+const wordsPerMinute = 200
+
+// Stats are the body's counts.
+type Stats struct {
+	Words int `json:"words"`
+	// Characters counts every character of the counted text, spaces between
+	// words included; CharactersNoSpaces leaves the spaces out.
+	Characters         int `json:"characters"`
+	CharactersNoSpaces int `json:"characters_no_spaces"`
+	// ReadingMinutes is the reading time at 200 words a minute, rounded up.
+	ReadingMinutes int `json:"reading_minutes"`
+}
+
+var statsKey = parser.NewContextKey()
+
+// StatsOf returns the counts the transformer recorded in pc while converting a
+// document; zero if the document hasn't been converted with the extension.
+func StatsOf(pc parser.Context) Stats {
+	s, _ := pc.Get(statsKey).(Stats)
+	return s
+}
+
+// countStats walks the transformed document and counts its text, leaving out
+// the parts named in exclude. Text is gathered per block, so a `$…$` span split
+// across inline nodes is still recognised as math.
+func countStats(doc gast.Node, source []byte, exclude []string) Stats {
+	skip := func(part string) bool { return slices.Contains(exclude, part) }
+	var s Stats
+	count := func(text string) {
+		for _, word := range strings.FieldsFunc(text, unicode.IsSpace) {
+			if strings.IndexFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+				s.Words++
+			}
+			n := utf8.RuneCountInString(word)
+			s.CharactersNoSpaces += n
+			s.Characters += n + 1
+		}
+	}
+	var block strings.Builder // inline text of the current block
+	flush := func() {
+		text := block.String()
+		block.Reset()
+		if skip("math") {
+			text = stripMath(text)
+		}
+		count(text)
+	}
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == gast.TypeBlock {
+				flush()
+			}
+			return gast.WalkContinue, nil
+		}
+		switch v := n.(type) {
+		case *Caption:
+			if skip("captions") {
+				return gast.WalkSkipChildren, nil
+			}
+		case *east.Footnote, *east.FootnoteList, *Sidenote:
+			if skip("footnotes") {
+				return gast.WalkSkipChildren, nil
+			}
+		case *gast.FencedCodeBlock, *gast.CodeBlock:
+			if !skip("code") {
+				count(string(v.Lines().Value(source)))
+			}
+			return gast.WalkSkipChildren, nil
+		case *gast.CodeSpan:
+			if !skip("code") {
+				block.WriteString(nodeText(v, source))
+			}
+			return gast.WalkSkipChildren, nil
+		case *Directive:
+			if v.Name == "bibliography" && !skip("bibliography") {
+				for _, e := range v.Bib {
+					if text := strings.TrimSpace(e.Ref.Text); text != "" {
+						count(stripTags(text))
+					} else {
+						count(formatReference(e.Ref))
+					}
+				}
+			}
+			return gast.WalkSkipChildren, nil
+		case *CaptionLabel, *SecNum, *gast.Image, *gast.RawHTML, *gast.HTMLBlock:
+			return gast.WalkSkipChildren, nil
+		case *gast.Text:
+			block.WriteString(decodeEntities(string(v.Segment.Value(source))))
+			if v.SoftLineBreak() || v.HardLineBreak() {
+				block.WriteByte(' ')
+			}
+		case *gast.String:
+			block.WriteString(decodeEntities(string(v.Value)))
+		case *Xref:
+			block.WriteString("0") // prints a number
+		case *Citation:
+			block.WriteString("[0]")
+		}
+		return gast.WalkContinue, nil
+	})
+	if s.Characters > 0 {
+		s.Characters-- // no space after the last word
+	}
+	s.ReadingMinutes = int(math.Ceil(float64(s.Words) / wordsPerMinute))
+	return s
+}
+
+// stripMath removes `$…$` and `$$…$$` spans (KaTeX math) from text. A
+// backslash-escaped `\$` is a literal dollar sign, and so is a `$` that opens
+// no inline math by typography's rule (see mathCloser), so prices count.
+func stripMath(text string) string {
+	rs := []rune(text)
+	var b strings.Builder
+	inMath := false
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\\' && i+1 < len(rs) && rs[i+1] == '$':
+			if !inMath {
+				b.WriteRune('$')
+			}
+			i++
+		case r == '$' && i+1 < len(rs) && rs[i+1] == '$':
+			inMath = !inMath
+			b.WriteByte(' ')
+			i++
+		case r == '$' && !inMath:
+			inMath = i+1 < len(rs) && !unicode.IsSpace(rs[i+1]) && closesMath(rs, i+1)
+			if inMath {
+				b.WriteByte(' ')
+			} else {
+				b.WriteRune('$')
+			}
+		case r == '$':
+			inMath = !mathCloser(rs, i)
+			b.WriteByte(' ')
+		case !inMath:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// stripTags drops HTML tags from a raw bibliography entry.
+func stripTags(html string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range html {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+			b.WriteRune(' ')
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return decodeEntities(b.String())
+}
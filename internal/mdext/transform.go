@@ -25,6 +25,16 @@ type transformer struct {
 
 func newTransformer(cfg Config) *transformer { return &transformer{cfg: cfg} }
 
+var headingsKey = parser.NewContextKey()
+
+// HeadingsOf returns the headings the transformer collected in pc for the
+// table of contents, in document order; nil if the document hasn't been
+// converted with the extension.
+func HeadingsOf(pc parser.Context) []HeadingEntry {
+	h, _ := pc.Get(headingsKey).([]HeadingEntry)
+	return h
+}
+
 func (t *transformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
 	source := reader.Source()
 
@@ -39,6 +49,10 @@ func (t *transformer) Transform(doc *gast.Document, reader text.Reader, pc parse
 	// into Matter containers (the numbering below reads the region per heading).
 	wrapMatter(doc)
 
+	// Pass 0b: turn GitHub `> [!NOTE]` alerts into callouts and title them.
+	convertAlerts(doc, source)
+	t.titleCallouts(doc)
+
 	// Pass 1: walk the document in order, numbering headings and captioned
 	// figures/tables. A heading's region sets the defaults (front = unnumbered +
 	// out of the TOC; main = decimal; appendix = lettered); per-heading classes
@@ -97,6 +111,9 @@ func (t *transformer) Transform(doc *gast.Document, reader text.Reader, pc parse
 				}
 				number = renderNumber(t.cfg.Numbering, counters, node.Level, isAppendix)
 				sn := NewSecNum(number)
+				if isAppendix && node.Level == 1 {
+					sn.Prefix = t.cfg.label("appendix")
+				}
 				if node.FirstChild() != nil {
 					node.InsertBefore(node, node.FirstChild(), sn)
 				} else {
@@ -142,7 +159,11 @@ func (t *transformer) Transform(doc *gast.Document, reader text.Reader, pc parse
 				node.ID = captionID(node.Variant, number)
 			}
 
-			title := buildCaption(node, source, t.cfg.label(node.Variant)+" "+number, labelClass(node.Variant))
+			sep := " "
+			if t.cfg.Smart {
+				sep = nbsp // "Figure 2.1" never breaks between label and number
+			}
+			title := buildCaption(node, source, t.cfg.label(node.Variant)+sep+number, labelClass(node.Variant))
 			entry := CaptionEntry{Number: number, Title: title, ID: node.ID}
 			if isTable {
 				tables = append(tables, entry)
@@ -207,6 +228,8 @@ func (t *transformer) Transform(doc *gast.Document, reader text.Reader, pc parse
 		return gast.WalkContinue, nil
 	})
 
+	pc.Set(headingsKey, headings)
+
 	// Pass 3: hand the collected data to the directive nodes.
 	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
 		d, ok := n.(*Directive)
@@ -230,6 +253,58 @@ func (t *transformer) Transform(doc *gast.Document, reader text.Reader, pc parse
 		}
 		return gast.WalkSkipChildren, nil
 	})
+
+	// Pass 4: count words and characters for {{.Stats}}.
+	pc.Set(statsKey, countStats(doc, source, t.cfg.StatsExclude))
+
+	// Pass 5: page.columns sets the main matter in columns.
+	if t.cfg.Columns > 1 {
+		wrapColumns(doc, t.cfg.Columns)
+	}
+}
+
+// pageDirectives are the directives that lay out pages of their own, which
+// page.columns leaves outside its columns.
+var pageDirectives = map[string]bool{
+	"titlepage": true,
+	"toc":       true,
+	"lof":       true,
+	"lot":       true,
+	"page":      true,
+}
+
+// wrapColumns sets the main matter in count columns: the children of the
+// mainmatter region, or of the whole document when it has no matter markers.
+// Each run of nodes between page directives (the title page, lists, page
+// breaks) becomes one Columns block, so those stay top-level siblings.
+func wrapColumns(doc *gast.Document, count int) {
+	var main gast.Node = doc
+	for c := doc.FirstChild(); c != nil; c = c.NextSibling() {
+		if m, ok := c.(*Matter); ok {
+			main = nil
+			if m.Region == "main" {
+				main = m
+				break
+			}
+		}
+	}
+	if main == nil {
+		return // front matter and appendix only
+	}
+	var cols *Columns
+	for c := main.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		if d, ok := c.(*Directive); ok && pageDirectives[d.Name] {
+			cols = nil
+		} else {
+			if cols == nil {
+				cols = NewColumns(count)
+				main.InsertBefore(main, c, cols)
+			}
+			cols.AppendChild(cols, c) // also detaches c from main
+		}
+		c = next
+	}
 }
 
 // wrapMatter replaces top-level `:::frontmatter` / `:::mainmatter` /
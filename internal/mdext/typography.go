@@ -0,0 +1,299 @@
+package mdext
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hinkolas/mdoc/internal/locale"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// typography.go is the optional smart-typography pass (`typography.smart`). It
+// rewrites body text the way a typesetter would, in the document's language:
+//
+//   - straight quotes become the language's typographic quotes ("…" -> „…“ in
+//     German, «…» in French), and an apostrophe between letters becomes ’;
+//   - a space between a number and a unit ("50 Hz", "3 %") and after a
+//     reference word ("Abb. 2", "page [#sec-x page]") becomes a no-break space;
+//   - a hyphen in a number range ("10-20") becomes an en dash, as do "--"
+//     ("---" is an em dash).
+//
+// Code spans, images, inline `$math$`, and backslash-escaped characters are
+// left alone, and a hyphenated run of numbers such as a date ("2026-03-01") is
+// not a range. Math follows the usual dollar rule: an opening `$` is followed
+// by a non-blank, and a closing one follows a non-blank and isn't followed by a
+// digit, so prices ("$5 and $10") are typeset as text. The pass runs before the
+// numbering transformer so TOC and list titles carry the same typography as the
+// headings they come from.
+
+// units are the unit symbols a preceding number is tied to with a no-break
+// space. A unit must end at a word boundary, so "5 mmHg" stays untouched.
+var units = []string{
+	"%", "‰", "°C", "°F", "°", "€", "£", "¥",
+	"nm", "µm", "mm", "cm", "dm", "m", "km", "ft",
+	"mg", "g", "kg", "ml", "L",
+	"ns", "µs", "ms", "s", "min", "h",
+	"Hz", "kHz", "MHz", "GHz",
+	"mV", "V", "kV", "mA", "A", "mW", "W", "kW", "MW", "Wh", "kWh",
+	"J", "kJ", "N", "kN", "Pa", "kPa", "MPa", "bar", "K", "Ω", "kΩ",
+	"B", "kB", "KB", "MB", "GB", "TB", "px", "pt",
+}
+
+const (
+	nbsp   = "\u00a0"
+	enDash = "\u2013"
+	emDash = "\u2014"
+)
+
+type typographer struct {
+	loc locale.Pack
+	// captions are the document's caption words, which count as reference
+	// words ("Abbildung 2") even when overridden in `labels`.
+	captions []string
+}
+
+func newTypographer(cfg Config) *typographer {
+	return &typographer{
+		loc:      locale.Get(cfg.Lang),
+		captions: []string{cfg.label("figure"), cfg.label("table")},
+	}
+}
+
+// span is one inline of a block's text flow: a text node to rewrite, or a
+// non-text inline (node nil) that only provides context to its neighbours.
+type span struct {
+	node *gast.Text
+	// stand is the character a non-text inline stands for: '0' for a
+	// cross-reference or citation (it prints a number), 'x' for anything else.
+	stand rune
+}
+
+func (t *typographer) Transform(doc *gast.Document, reader text.Reader, _ parser.Context) {
+	source := reader.Source()
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering || n.Type() != gast.TypeBlock || n.FirstChild() == nil || n.FirstChild().Type() != gast.TypeInline {
+			return gast.WalkContinue, nil
+		}
+		t.rewrite(collectSpans(n, nil), source)
+		return gast.WalkSkipChildren, nil
+	})
+}
+
+// collectSpans flattens the inline children of n into spans, in order.
+func collectSpans(n gast.Node, spans []span) []span {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch v := c.(type) {
+		case *gast.Text:
+			if v.IsRaw() {
+				spans = append(spans, span{stand: 'x'})
+			} else {
+				spans = append(spans, span{node: v})
+			}
+		case *gast.CodeSpan, *gast.Image, *gast.AutoLink, *gast.RawHTML, *gast.String:
+			spans = append(spans, span{stand: 'x'})
+		case *Xref, *Citation:
+			spans = append(spans, span{stand: '0'})
+		default:
+			spans = collectSpans(c, spans)
+		}
+	}
+	return spans
+}
+
+// rewrite typesets one block. Its spans are laid out as a single run of
+// characters (goldmark splits text at arbitrary points, e.g. at spaces for
+// linkify, so rules must see across nodes); non-text inlines and line breaks
+// join the run as context only. Each output piece is credited to the text node
+// its first character came from, and nodes whose text changed are replaced.
+func (t *typographer) rewrite(spans []span, source []byte) {
+	var rs []rune
+	var owner []int // span index of each rune; -1 for context
+	for i, sp := range spans {
+		if sp.node == nil {
+			rs, owner = append(rs, sp.stand), append(owner, -1)
+			continue
+		}
+		for _, r := range string(sp.node.Segment.Value(source)) {
+			rs, owner = append(rs, r), append(owner, i)
+		}
+		if sp.node.SoftLineBreak() || sp.node.HardLineBreak() {
+			rs, owner = append(rs, '\n'), append(owner, -1)
+		}
+	}
+	out := make([]strings.Builder, len(spans))
+	t.typeset(rs, func(i int, s string) {
+		if owner[i] >= 0 {
+			out[owner[i]].WriteString(s)
+		}
+	})
+	for i, sp := range spans {
+		if sp.node != nil && out[i].String() != string(sp.node.Segment.Value(source)) {
+			replaceText(sp.node, out[i].String())
+		}
+	}
+}
+
+// replaceText swaps a text node for a String carrying the rewritten text. A
+// line break is kept on an empty text node after it, since only text nodes
+// render one.
+func replaceText(n *gast.Text, value string) {
+	parent := n.Parent()
+	parent.InsertBefore(parent, n, gast.NewString([]byte(value)))
+	if n.SoftLineBreak() || n.HardLineBreak() {
+		br := gast.NewTextSegment(text.NewSegment(n.Segment.Stop, n.Segment.Stop))
+		br.SetSoftLineBreak(n.SoftLineBreak())
+		br.SetHardLineBreak(n.HardLineBreak())
+		parent.InsertBefore(parent, n, br)
+	}
+	parent.RemoveChild(parent, n)
+}
+
+// typeset applies the rules to a run of characters, calling emit with the
+// index of the first character each output piece replaces.
+func (t *typographer) typeset(rs []rune, emit func(i int, s string)) {
+	at := func(i int) rune {
+		if i < 0 || i >= len(rs) {
+			return ' '
+		}
+		return rs[i]
+	}
+	math := false
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\\' && i+1 < len(rs):
+			emit(i, string(rs[i:i+2]))
+			i++
+			continue
+		case r == '$' && at(i+1) == '$': // $$ display math
+			math = !math
+			emit(i, "$$")
+			i++
+			continue
+		case r == '$' && !math:
+			math = !unicode.IsSpace(at(i+1)) && closesMath(rs, i+1)
+		case r == '$':
+			math = !mathCloser(rs, i)
+		}
+		if math || r == '$' {
+			emit(i, string(r))
+			continue
+		}
+		switch r {
+		case '"':
+			if opens(at(i-1), at(i+1)) {
+				emit(i, t.loc.Quotes[0])
+			} else {
+				emit(i, t.loc.Quotes[1])
+			}
+		case '\'':
+			switch before, after := at(i-1), at(i+1); {
+			case isWordRune(before) && isWordRune(after):
+				emit(i, "\u2019") // apostrophe
+			case opens(before, after):
+				emit(i, t.loc.Quotes[2])
+			default:
+				emit(i, t.loc.Quotes[3])
+			}
+		case '-':
+			switch {
+			case at(i+1) == '-' && at(i+2) == '-':
+				emit(i, emDash)
+				i += 2
+			case at(i+1) == '-':
+				emit(i, enDash)
+				i++
+			case isRange(rs, i, at):
+				emit(i, enDash)
+			default:
+				emit(i, "-")
+			}
+		case ' ':
+			if t.tiesSpace(rs, i, at) {
+				emit(i, nbsp)
+			} else {
+				emit(i, " ")
+			}
+		default:
+			emit(i, string(r))
+		}
+	}
+}
+
+// mathCloser reports whether the '$' at rs[i] can close inline math: it follows
+// a non-blank and isn't followed by a digit, so "$5 and $10" holds no math.
+func mathCloser(rs []rune, i int) bool {
+	return i > 0 && !unicode.IsSpace(rs[i-1]) && (i+1 >= len(rs) || !unicode.IsDigit(rs[i+1]))
+}
+
+// closesMath reports whether a '$' that can close inline math (see mathCloser)
+// follows in rs[from:]. An opening '$' without one is a literal dollar sign.
+func closesMath(rs []rune, from int) bool {
+	for i := from; i < len(rs); i++ {
+		switch {
+		case rs[i] == '\\':
+			i++
+		case rs[i] == '$' && mathCloser(rs, i):
+			return true
+		}
+	}
+	return false
+}
+
+// opens reports whether a quote between before and after opens a quotation:
+// it follows a space or opening punctuation and is followed by something.
+func opens(before, after rune) bool {
+	if unicode.IsSpace(after) {
+		return false
+	}
+	return unicode.IsSpace(before) || strings.ContainsRune("([{—–-/", before)
+}
+
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+// isRange reports whether the hyphen at rs[i] joins two numbers ("10-20") that
+// are not part of a longer hyphenated run such as a date or phone number.
+func isRange(rs []rune, i int, at func(int) rune) bool {
+	if !unicode.IsDigit(at(i-1)) || !unicode.IsDigit(at(i+1)) {
+		return false
+	}
+	j := i - 1
+	for j >= 0 && unicode.IsDigit(rs[j]) {
+		j--
+	}
+	k := i + 1
+	for k < len(rs) && unicode.IsDigit(rs[k]) {
+		k++
+	}
+	before, after := at(j), at(k)
+	return before != '-' && !unicode.IsLetter(before) && after != '-' && !unicode.IsLetter(after)
+}
+
+// tiesSpace reports whether the space at rs[i] should not break: it sits
+// between a number and a unit, or between a reference word and a number.
+func (t *typographer) tiesSpace(rs []rune, i int, at func(int) rune) bool {
+	if unicode.IsDigit(at(i - 1)) {
+		rest := string(rs[i+1:])
+		for _, u := range units {
+			if after, ok := strings.CutPrefix(rest, u); ok {
+				r, _ := utf8.DecodeRuneInString(after)
+				if after == "" || !isWordRune(r) {
+					return true
+				}
+			}
+		}
+	}
+	if !unicode.IsDigit(at(i + 1)) {
+		return false
+	}
+	j := i
+	for j > 0 && !unicode.IsSpace(rs[j-1]) {
+		j--
+	}
+	word := string(rs[j:i])
+	return slices.Contains(t.loc.Abbrevs, word) || slices.Contains(t.captions, word)
+}
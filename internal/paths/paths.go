@@ -1,8 +1,8 @@
 // Package paths resolves mdoc's per-user directories.
 //
-// User-authored files (themes, and any future hand-edited config) live under
-// an XDG-style config directory — $XDG_CONFIG_HOME/mdoc when set, otherwise
-// ~/.config/mdoc — on every platform. That's deliberately the same friendly
+// User-authored files (themes, includes, and the config.yaml settings file)
+// live under an XDG-style config directory — $XDG_CONFIG_HOME/mdoc when set,
+// otherwise ~/.config/mdoc — on every platform. That's deliberately the same friendly
 // ~/.config path everywhere rather than os.UserConfigDir's platform default
 // (e.g. ~/Library/Application Support on macOS), since users have to drop
 // theme files in by hand and navigating to Library isn't ergonomic.
@@ -31,6 +31,17 @@ func ConfigDir() (string, error) {
 	return filepath.Join(home, ".config", "mdoc"), nil
 }
 
+// ConfigFile returns the path of the per-user settings file,
+// <ConfigDir>/config.yaml. It may not exist; a missing file means "no user
+// settings", not an error.
+func ConfigFile() (string, error) {
+	cfg, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cfg, "config.yaml"), nil
+}
+
 // ThemesDir returns the user-level themes directory, <ConfigDir>/themes.
 func ThemesDir() (string, error) {
 	cfg, err := ConfigDir()
@@ -0,0 +1,125 @@
+package preview
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// tokenCookie carries the access token after the first request that presented
+// it in the URL, so the SPA's fetches, the iframe and the WebSocket don't have
+// to thread it through every URL.
+const tokenCookie = "mdoc_token"
+
+// isLoopback reports whether host names this machine only.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// fromLoopback reports whether r came from this machine.
+func fromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	return err == nil && isLoopback(host)
+}
+
+// newToken returns a random access token for a server reachable from the
+// network.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// authorize guards a server bound beyond loopback: every request from another
+// machine must carry the access token, either as ?token= on the URL it was
+// opened with or in the cookie that request sets. Clients on this machine —
+// the preview window, an editor posting /goto — are let through as they are
+// on a loopback-only server.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fromLoopback(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.validToken(r.URL.Query().Get("token")) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    s.token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c, err := r.Cookie(tokenCookie); err == nil && s.validToken(c.Value) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "missing or wrong access token", http.StatusForbidden)
+	})
+}
+
+func (s *Server) validToken(t string) bool {
+	return t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(s.token)) == 1
+}
+
+// localOnly restricts an endpoint that acts on this machine — opening the
+// editor or the system browser — to clients on this machine. Remote viewers
+// can follow the preview but not launch programs on the host.
+func localOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !fromLoopback(r) {
+			http.Error(w, "only available on the machine running mdoc", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// jsonFromSameOrigin guards a POST that acts on this machine against other
+// websites: a page on any origin can make the browser send a "simple" POST
+// (text/plain, no preflight) to a localhost port. So the body must be declared
+// application/json, which a cross-origin page can't send without a CORS
+// preflight this server never grants, and a browser's request must come from
+// the preview itself, going by Sec-Fetch-Site and Origin. Tools that aren't
+// browsers, such as an editor posting /goto, send neither header.
+func jsonFromSameOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+			http.Error(w, "expected a Content-Type: application/json body", http.StatusUnsupportedMediaType)
+			return
+		}
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// sameOrigin reports whether r, if a browser sent it, came from a page served
+// by this server.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
@@ -0,0 +1,75 @@
+package preview
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hinkolas/mdoc/internal/config"
+)
+
+// guiEditors maps the GUI editors the $VISUAL / $EDITOR fallback may start to
+// the arguments that open file at line. A terminal editor (vi, nano, emacs -nw)
+// has no terminal to draw on when the preview server starts it, so it would
+// hang out of sight; those need preview.editor, e.g. a terminal emulator
+// running them.
+var guiEditors = map[string]func(file, line string) []string{
+	"code":          vscodeArgs,
+	"code-insiders": vscodeArgs,
+	"codium":        vscodeArgs,
+	"cursor":        vscodeArgs,
+	"subl":          func(file, line string) []string { return []string{file + ":" + line} },
+	"zed":           func(file, line string) []string { return []string{file + ":" + line} },
+	"gvim":          plusLineArgs,
+	"mvim":          plusLineArgs,
+	"gedit":         plusLineArgs,
+	"kate":          func(file, line string) []string { return []string{"-l", line, file} },
+}
+
+func vscodeArgs(file, line string) []string   { return []string{"-g", file + ":" + line} }
+func plusLineArgs(file, line string) []string { return []string{"+" + line, file} }
+
+// openInEditor opens file at line in the user's editor: the preview.editor
+// command from the user config, with its {file} and {line} placeholders filled
+// in, or else $VISUAL / $EDITOR when it names a known GUI editor (see
+// guiEditors). The editor is started, not waited for.
+func openInEditor(file string, line int) error {
+	user, err := config.Load()
+	if err != nil {
+		return err
+	}
+	var args []string
+	if tmpl := user.Preview.Editor; tmpl != "" {
+		// Split before substituting so a path with spaces stays one argument.
+		r := strings.NewReplacer("{file}", file, "{line}", strconv.Itoa(line))
+		for _, f := range strings.Fields(tmpl) {
+			args = append(args, r.Replace(f))
+		}
+	} else {
+		env := "VISUAL"
+		editor := os.Getenv(env)
+		if editor == "" {
+			env = "EDITOR"
+			editor = os.Getenv(env)
+		}
+		fields := strings.Fields(editor)
+		if len(fields) == 0 {
+			return fmt.Errorf("no editor: set preview.editor in the user config")
+		}
+		name := strings.TrimSuffix(filepath.Base(fields[0]), ".exe")
+		editorArgs, ok := guiEditors[name]
+		if !ok {
+			return fmt.Errorf("$%s (%s) isn't a known GUI editor, and a terminal editor can't open without a terminal: set preview.editor in the user config", env, name)
+		}
+		args = append(fields, editorArgs(file, strconv.Itoa(line))...)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start editor: %w", err)
+	}
+	go func() { _ = cmd.Wait() }() // reap it
+	return nil
+}
@@ -7,29 +7,44 @@ import (
 
 // message is the wire format for WebSocket frames in both directions.
 // The protocol is intentionally minimal: the server pushes "reload" when
-// the document or theme changes and the iframe re-fetches /preview. There
-// is no per-message HTML payload.
+// the document or theme changes and the iframe re-fetches /preview, and
+// "goto" with a File and Line when an editor asks the preview to show a
+// source line (see handleGoto). There is no per-message HTML payload. An
+// "error" is what a failed /preview/body or /preview/patch answers with.
 type message struct {
 	Event string `json:"event"`
+	// File and Line name a source position for "goto" and "error", in the
+	// form blocks carry it as data-src: the file relative to the document's
+	// directory.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// Message and Frame describe an "error": the error text and the source
+	// lines around Line.
+	Message string      `json:"message,omitempty"`
+	Frame   []frameLine `json:"frame,omitempty"`
 }
 
-// sendMessage marshals and queues a frame for the connected client. Returns
-// an error if no client is connected or the send buffer is full.
+// frameLine is one line of an error's code frame.
+type frameLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// PushGoto tells the connected clients to scroll to the block at line of file,
+// a path relative to the document's directory.
+func (s *Server) PushGoto(file string, line int) error {
+	return s.sendMessage(message{Event: "goto", File: file, Line: line})
+}
+
+// sendMessage marshals a frame and broadcasts it to every connected client.
+// Returns an error if no client received it.
 func (s *Server) sendMessage(m message) error {
-	s.mu.RLock()
-	send := s.send
-	s.mu.RUnlock()
-	if send == nil {
-		return fmt.Errorf("no client connected")
-	}
 	data, err := json.Marshal(m)
 	if err != nil {
 		return fmt.Errorf("marshal: %w", err)
 	}
-	select {
-	case send <- data:
-		return nil
-	default:
-		return fmt.Errorf("send buffer full")
+	if s.hub.broadcast(data) == 0 {
+		return fmt.Errorf("no client connected")
 	}
+	return nil
 }
@@ -0,0 +1,80 @@
+package preview
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// client is one connected preview window: its socket and the queue of frames
+// its write pump drains.
+type client struct {
+	conn *websocket.Conn
+	send chan []byte
+}
+
+func newClient(conn *websocket.Conn) *client {
+	return &client{conn: conn, send: make(chan []byte, 32)}
+}
+
+// writePump writes queued frames to the socket until the hub closes the queue
+// or a write fails.
+func (c *client) writePump() {
+	for data := range c.send {
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return
+		}
+	}
+}
+
+// hub tracks every connected client and broadcasts frames to all of them, so
+// any number of windows — a second monitor, a colleague on the LAN — follow
+// the same preview. The zero value is ready to use.
+type hub struct {
+	mu      sync.Mutex
+	clients map[*client]struct{}
+}
+
+func (h *hub) add(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients == nil {
+		h.clients = map[*client]struct{}{}
+	}
+	h.clients[c] = struct{}{}
+}
+
+// remove unregisters c and closes its queue, which ends its write pump.
+// Removing a client twice is a no-op.
+func (h *hub) remove(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop(c)
+}
+
+func (h *hub) drop(c *client) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	close(c.send)
+}
+
+// broadcast queues data for every client and returns how many got it. A
+// client whose queue is full has stopped reading; it is dropped and its socket
+// closed rather than letting it hold up the others.
+func (h *hub) broadcast(data []byte) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for c := range h.clients {
+		select {
+		case c.send <- data:
+			n++
+		default:
+			h.drop(c)
+			_ = c.conn.Close()
+		}
+	}
+	return n
+}
@@ -8,12 +8,12 @@ import (
 	"strings"
 )
 
-// openInDefaultBrowser launches the system's default handler for the
+// OpenInDefaultBrowser launches the system's default handler for the
 // given URL — the equivalent of double-clicking it in the file manager.
 // Only http/https/mailto schemes are accepted; anything else is rejected
 // so the exec call can't be tricked into running an arbitrary scheme
 // handler from untrusted document content.
-func openInDefaultBrowser(raw string) error {
+func OpenInDefaultBrowser(raw string) error {
 	u, err := url.Parse(raw)
 	if err != nil {
 		return fmt.Errorf("invalid url: %w", err)
@@ -0,0 +1,51 @@
+package preview
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hinkolas/mdoc/internal/render"
+)
+
+// frameContext is how many source lines an error's code frame shows on each
+// side of the offending line.
+const frameContext = 2
+
+// errorMessage turns a failed render into the "error" event the preview's
+// overlay shows. Errors pinned to a source line (render.SourceError) carry
+// that file, line and a code frame; anything else — an unreadable document,
+// broken frontmatter — is just the message.
+func (s *Server) errorMessage(err error) message {
+	m := message{Event: "error", Message: err.Error()}
+	var se *render.SourceError
+	if !errors.As(err, &se) {
+		return m
+	}
+	m.File = se.File
+	if rel, err := filepath.Rel(filepath.Dir(s.docPath), se.File); err == nil && !strings.HasPrefix(rel, "..") {
+		m.File = filepath.ToSlash(rel)
+	}
+	m.Line = se.Line
+	m.Frame = codeFrame(se.File, se.Line)
+	return m
+}
+
+// codeFrame returns the lines of file around line, or nil if the file can't
+// be read or is shorter than line.
+func codeFrame(file string, line int) []frameLine {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	var frame []frameLine
+	for n := max(line-frameContext, 1); n <= min(line+frameContext, len(lines)); n++ {
+		frame = append(frame, frameLine{Line: n, Text: lines[n-1]})
+	}
+	return frame
+}
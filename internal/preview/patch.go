@@ -0,0 +1,130 @@
+package preview
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/hinkolas/mdoc/internal/render"
+)
+
+// historySize is how many past renders the server remembers for
+// /preview/patch. A client further behind than that gets a full repaint.
+const historySize = 8
+
+// renderHistory keeps the last few renders served to the preview, split into
+// top-level blocks (see render.SplitBlocks), so /preview/patch can answer with
+// just the blocks that changed since the render a client shows.
+type renderHistory struct {
+	mu      sync.Mutex
+	renders []snapshot // oldest first
+	next    int
+}
+
+// snapshot is one render in the history.
+type snapshot struct {
+	version        int
+	prefix, suffix string
+	blocks         []render.Block
+}
+
+// record adds a render to the history and returns it. ok is false when it
+// carries no block markers to patch with. A render identical to the latest one
+// keeps that one's version.
+func (h *renderHistory) record(themed string) (snap snapshot, ok bool) {
+	prefix, blocks, suffix, ok := render.SplitBlocks(themed)
+	if !ok {
+		return snapshot{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n := len(h.renders); n > 0 {
+		last := h.renders[n-1]
+		if last.prefix == prefix && last.suffix == suffix && slices.Equal(last.blocks, blocks) {
+			return last, true
+		}
+	}
+	h.next++
+	snap = snapshot{version: h.next, prefix: prefix, suffix: suffix, blocks: blocks}
+	h.renders = append(h.renders, snap)
+	if len(h.renders) > historySize {
+		h.renders = slices.Delete(h.renders, 0, len(h.renders)-historySize)
+	}
+	return snap, true
+}
+
+// lookup returns the render with the given version.
+func (h *renderHistory) lookup(version int) (snapshot, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.renders {
+		if r.version == version {
+			return r, true
+		}
+	}
+	return snapshot{}, false
+}
+
+// patch is the /preview/patch response: the render at Version is the base
+// render's first Keep blocks followed by Blocks. A block the base already had
+// comes without its HTML. Full means the change can't be expressed that way —
+// the base is unknown, or the theme's markup around the body changed — and
+// the client should re-fetch /preview/body.
+type patch struct {
+	Version int            `json:"version"`
+	Full    bool           `json:"full,omitempty"`
+	Keep    int            `json:"keep"`
+	Blocks  []render.Block `json:"blocks"`
+}
+
+// diff returns the patch that turns base into cur.
+func diff(base, cur snapshot) patch {
+	p := patch{Version: cur.version, Blocks: []render.Block{}}
+	if base.prefix != cur.prefix || base.suffix != cur.suffix {
+		p.Full = true
+		return p
+	}
+	for p.Keep < len(base.blocks) && p.Keep < len(cur.blocks) && base.blocks[p.Keep].ID == cur.blocks[p.Keep].ID {
+		p.Keep++
+	}
+	known := make(map[string]bool, len(base.blocks))
+	for _, b := range base.blocks {
+		known[b.ID] = true
+	}
+	for _, b := range cur.blocks[p.Keep:] {
+		if known[b.ID] {
+			b.HTML = ""
+		}
+		p.Blocks = append(p.Blocks, b)
+	}
+	return p
+}
+
+// handlePreviewPatch re-renders the document and answers with what changed
+// since the render the client shows, named by ?base= (the X-Mdoc-Version of
+// its last /preview/body or the version of its last patch), so the iframe can
+// re-paginate from the first affected page instead of from the top. Like
+// /preview/body, the language rides along in X-Mdoc-Lang and a failed render
+// answers 500 with the "error" message.
+func (s *Server) handlePreviewPatch(w http.ResponseWriter, r *http.Request) {
+	html, td, err := s.renderBody()
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(s.errorMessage(err))
+		return
+	}
+	w.Header().Set("X-Mdoc-Lang", td.Lang)
+	p := patch{Full: true}
+	if cur, ok := s.history.record(html); ok {
+		baseVersion, _ := strconv.Atoi(r.URL.Query().Get("base"))
+		if base, ok := s.history.lookup(baseVersion); ok {
+			p = diff(base, cur)
+		}
+		p.Version = cur.version
+	}
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -1,11 +1,13 @@
 // Package preview runs the live-preview HTTP server: serves the SPA, an
 // iframe-hosted paged.js view of the document, pushes a reload signal over
-// WebSocket on file changes, and exposes /print to trigger PDF generation.
+// WebSocket to every connected client on file changes, and exposes /print to
+// trigger PDF generation.
 package preview
 
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"html/template"
 	"io"
 	"log"
@@ -13,30 +15,36 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 
 	"github.com/hinkolas/mdoc/internal/assets"
 	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/mdext"
 	"github.com/hinkolas/mdoc/internal/print"
 	"github.com/hinkolas/mdoc/internal/render"
 	"github.com/hinkolas/mdoc/internal/theme"
 )
 
-// Server is a single-client live-preview server bound to one source document.
+// Server is a live-preview server bound to one source document. Any number of
+// clients can follow it at once.
 type Server struct {
 	docPath string
 	version string
 
+	hub          hub
+	history      renderHistory
 	mu           sync.RWMutex
-	conn         *websocket.Conn
-	send         chan []byte
 	httpSrv      *http.Server
+	host         string
 	port         int
-	themeWarning string // last non-fatal theme diagnostic, surfaced via /status
+	token        string   // access token; set when bound beyond loopback
+	themeWarning string   // last non-fatal theme diagnostic, surfaced via /status
+	assets       []string // files outside the doc dir the last render links, for serveDocAssets
 }
 
 // New returns a server for the given document. The document is re-read from
@@ -49,33 +57,95 @@ func New(docPath, version string) *Server {
 // Port returns the port the server is listening on. Only valid after Start.
 func (s *Server) Port() int { return s.port }
 
-// URL returns the preview origin (no path).
-func (s *Server) URL() string { return fmt.Sprintf("http://127.0.0.1:%d/", s.port) }
+// URL returns the preview URL to open on this machine: the origin, plus the
+// access token when the server is reachable from the network.
+func (s *Server) URL() string {
+	host := s.host
+	if isLoopback(host) || net.ParseIP(host).IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return s.urlFor(host)
+}
+
+// NetworkURLs returns the URLs other machines can open the preview at, with
+// the access token: one per non-loopback IPv4 address when bound to all
+// interfaces. Nil for a loopback-only server.
+func (s *Server) NetworkURLs() []string {
+	if s.token == "" {
+		return nil
+	}
+	if !net.ParseIP(s.host).IsUnspecified() {
+		return []string{s.urlFor(s.host)}
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var urls []string
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.To4() == nil {
+			continue
+		}
+		urls = append(urls, s.urlFor(ipnet.IP.String()))
+	}
+	return urls
+}
+
+func (s *Server) urlFor(host string) string {
+	u := fmt.Sprintf("http://%s/", net.JoinHostPort(host, strconv.Itoa(s.port)))
+	if s.token != "" {
+		u += "?token=" + s.token
+	}
+	return u
+}
 
 // DocPath is the absolute path of the document this server is serving.
 func (s *Server) DocPath() string { return s.docPath }
 
-// Start binds the server (port 0 = auto-pick) and serves in the background.
-func (s *Server) Start(port int) error {
-	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+// Start binds the server to host ("" = 127.0.0.1; port 0 = auto-pick) and
+// serves in the background. A host beyond loopback, such as 0.0.0.0, makes the
+// preview reachable from the network, so every request then needs the random
+// access token that URL and NetworkURLs carry.
+func (s *Server) Start(host string, port int) error {
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if !isLoopback(host) {
+		token, err := newToken()
+		if err != nil {
+			return fmt.Errorf("access token: %w", err)
+		}
+		s.token = token
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 	if err != nil {
 		return fmt.Errorf("listen: %w", err)
 	}
+	s.host = host
 	s.port = ln.Addr().(*net.TCPAddr).Port
 
 	r := mux.NewRouter()
 	r.HandleFunc("/", s.handleIndex).Methods("GET")
 	r.HandleFunc("/preview", s.handlePreview).Methods("GET")
 	r.HandleFunc("/preview/body", s.handlePreviewBody).Methods("GET")
+	r.HandleFunc("/preview/patch", s.handlePreviewPatch).Methods("GET")
 	r.HandleFunc("/ws", s.handleWebSocket)
 	r.HandleFunc("/print", s.handlePrint).Methods("POST")
 	r.HandleFunc("/status", s.handleStatus).Methods("GET")
-	r.HandleFunc("/open-url", s.handleOpenURL).Methods("POST")
+	r.HandleFunc("/outline", s.handleOutline).Methods("GET")
+	r.HandleFunc("/open-url", localOnly(jsonFromSameOrigin(s.handleOpenURL))).Methods("POST")
+	r.HandleFunc("/edit", localOnly(jsonFromSameOrigin(s.handleEdit))).Methods("POST")
+	r.HandleFunc("/goto", localOnly(jsonFromSameOrigin(s.handleGoto))).Methods("POST")
 	r.PathPrefix("/_/ui/").Handler(http.StripPrefix("/_/ui/", http.FileServer(http.FS(assets.UI()))))
 	r.PathPrefix("/_/vendor/").Handler(http.StripPrefix("/_/vendor/", http.FileServer(http.FS(assets.Vendor()))))
 	r.PathPrefix("/assets/").HandlerFunc(s.serveDocAssets)
 
-	s.httpSrv = &http.Server{Handler: r}
+	var handler http.Handler = r
+	if s.token != "" {
+		handler = s.authorize(r)
+	}
+	s.httpSrv = &http.Server{Handler: handler}
 	go func() {
 		if err := s.httpSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Printf("preview server: %v", err)
@@ -93,7 +163,9 @@ func (s *Server) Shutdown() error {
 }
 
 // PushReload notifies the connected client that the underlying document or
-// theme changed and the iframe should be reloaded.
+// theme changed and the iframe should be reloaded. Nothing is rendered here:
+// the client's /preview/patch or /preview/body fetch does that once, and a
+// failed one answers with the "error" the overlay shows.
 func (s *Server) PushReload() error {
 	return s.sendMessage(message{Event: "reload"})
 }
@@ -108,11 +180,20 @@ func (s *Server) resolve() (*document.Document, *theme.Theme, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	thm, warn := theme.Resolve(doc.Config.Theme, doc.Dir)
+	thm, warn := theme.Resolve(doc.Config.Theme, doc.Dir, doc.Project)
 	s.setThemeWarning(warn)
 	return doc, thm, nil
 }
 
+// setAssets records the files outside the document's directory a render of it
+// links to (see document.Document.Assets), the only ones serveDocAssets serves
+// from there.
+func (s *Server) setAssets(doc *document.Document) {
+	s.mu.Lock()
+	s.assets = doc.Assets
+	s.mu.Unlock()
+}
+
 func (s *Server) setThemeWarning(err error) {
 	msg := ""
 	if err != nil {
@@ -140,16 +221,16 @@ func (s *Server) CurrentTheme() (path, warning, docErr string) {
 	return thm.Path, warning, ""
 }
 
-// CurrentIncludes re-reads the document and reports the absolute paths of the
-// files it pulls in via `:::include`, so the watcher can follow them. A document
-// that can't be read (e.g. mid-edit) yields nil — the render path reports that
-// error separately; here we just leave the include watch set unchanged-worthy.
-func (s *Server) CurrentIncludes() []string {
+// CurrentDependencies re-reads the document and reports the absolute paths of
+// the other files its render depends on (see document.Dependencies), so the
+// watcher can follow them. A document that can't be read (e.g. mid-edit) yields
+// nil — the render path reports that error separately.
+func (s *Server) CurrentDependencies() []string {
 	doc, err := document.Open(s.docPath)
 	if err != nil {
 		return nil
 	}
-	return doc.Includes
+	return doc.Dependencies()
 }
 
 // handleStatus reports the latest non-fatal preview diagnostic — currently
@@ -164,6 +245,25 @@ func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
 	_ = json.NewEncoder(w).Encode(map[string]string{"warning": warn})
 }
 
+// handleOutline reports the document's heading tree for the sidebar: the
+// headings that go into the table of contents, with their numbers and ids.
+// A failed render answers 500 with the "error" message, like /preview/body.
+func (s *Server) handleOutline(w http.ResponseWriter, _ *http.Request) {
+	_, td, err := s.renderBody()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(s.errorMessage(err))
+		return
+	}
+	headings := td.Headings
+	if headings == nil {
+		headings = []mdext.HeadingEntry{}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"headings": headings})
+}
+
 // handleIndex serves the preview SPA chrome (header + iframe).
 func (s *Server) handleIndex(w http.ResponseWriter, _ *http.Request) {
 	doc, err := document.Open(s.docPath)
@@ -181,8 +281,15 @@ func (s *Server) handleIndex(w http.ResponseWriter, _ *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// The toolbar keeps its view settings per document under a key derived
+	// from the path, which it shouldn't reveal to a networked viewer.
+	h := fnv.New64a()
+	_, _ = io.WriteString(h, s.docPath)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_ = t.Execute(w, map[string]any{"Title": doc.Config.Title})
+	_ = t.Execute(w, map[string]any{
+		"Title":  doc.Config.Title,
+		"DocKey": strconv.FormatUint(h.Sum64(), 36),
+	})
 }
 
 // handlePreview returns the document re-rendered through the same shell.html
@@ -198,7 +305,9 @@ func (s *Server) handlePreview(w http.ResponseWriter, _ *http.Request) {
 		VendorBase: "/_/vendor",
 		BaseHref:   "/assets/",
 		Version:    s.version,
+		SourceMap:  true,
 	})
+	s.setAssets(doc)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -213,27 +322,48 @@ func (s *Server) handlePreview(w http.ResponseWriter, _ *http.Request) {
 // handlePreviewBody returns just the themed HTML (no shell wrap), used by
 // the iframe to re-paginate in place without a full reload. Theme @page
 // rules and other styles ride along inside <style> tags; the in-iframe
-// paginate function extracts them and feeds them to paged.js's Polisher.
+// paginate function extracts them and feeds them to paged.js's Polisher. The
+// document language rides along in X-Mdoc-Lang so the iframe's <html lang>
+// (which drives hyphenation) follows a `lang` edit without a full reload,
+// and the render's version in X-Mdoc-Version, the base for the next
+// /preview/patch. A failed render answers 500 with the "error" message as
+// JSON.
 func (s *Server) handlePreviewBody(w http.ResponseWriter, _ *http.Request) {
-	doc, thm, err := s.resolve()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	html, _, err := render.RenderThemed(doc, thm, render.Options{
-		VendorBase: "/_/vendor",
-		BaseHref:   "/assets/",
-		Version:    s.version,
-	})
+	html, td, err := s.renderBody()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(s.errorMessage(err))
 		return
 	}
 	w.Header().Set("Cache-Control", "no-store")
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Mdoc-Lang", td.Lang)
+	if snap, ok := s.history.record(html); ok {
+		w.Header().Set("X-Mdoc-Version", strconv.Itoa(snap.version))
+	}
 	_, _ = io.WriteString(w, html)
 }
 
+// renderBody renders the themed document body the way /preview/body serves it,
+// with block markers for /preview/patch.
+func (s *Server) renderBody() (string, render.ThemeData, error) {
+	doc, thm, err := s.resolve()
+	if err != nil {
+		return "", render.ThemeData{}, err
+	}
+	html, td, err := render.RenderThemed(doc, thm, render.Options{
+		VendorBase:   "/_/vendor",
+		BaseHref:     "/assets/",
+		Version:      s.version,
+		SourceMap:    true,
+		BlockMarkers: true,
+	})
+	s.setAssets(doc)
+	return html, td, err
+}
+
 func (s *Server) handlePrint(w http.ResponseWriter, _ *http.Request) {
 	doc, thm, err := s.resolve()
 	if err != nil {
@@ -276,24 +406,89 @@ func (s *Server) handleOpenURL(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := openInDefaultBrowser(body.URL); err != nil {
+	if err := OpenInDefaultBrowser(body.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEdit receives the data-src of a block Ctrl-clicked in the preview and
+// opens that source line in the user's editor. Only the document and the
+// files it includes can be opened, so a page can't point the editor at an
+// arbitrary path.
+func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		File string `json:"file"`
+		Line int    `json:"line"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	doc, err := document.Open(s.docPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	file := filepath.Join(doc.Dir, filepath.FromSlash(body.File))
+	if file != doc.Path && !slices.Contains(doc.Includes, file) {
+		http.Error(w, "not a source of this document: "+body.File, http.StatusBadRequest)
+		return
+	}
+	if err := openInEditor(file, max(body.Line, 1)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGoto is the editor-to-preview half of source sync: an editor posts
+// {file, line} as the cursor moves, and the preview scrolls to the page with
+// that line's block and flashes it. file may be absolute or relative to the
+// document's directory.
+func (s *Server) handleGoto(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		File string `json:"file"`
+		Line int    `json:"line"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if body.File == "" {
+		body.File = s.docPath
+	}
+	file := body.File
+	if filepath.IsAbs(file) {
+		rel, err := filepath.Rel(filepath.Dir(s.docPath), file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file = rel
+	}
+	if err := s.PushGoto(filepath.ToSlash(filepath.Clean(file)), max(body.Line, 1)); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // serveDocAssets exposes files inside the document's directory at /assets/*
-// so the preview can resolve relative <img>/<a> references. Path traversal
-// is blocked: the resolved absolute path must stay inside docDir.
+// so the preview can resolve relative <img>/<a> references, plus the files
+// outside it that the rebased URLs of included files name (see
+// document.AssetFile). Path traversal is blocked: the resolved path must stay
+// inside the document's directory or be one of those files.
 func (s *Server) serveDocAssets(w http.ResponseWriter, r *http.Request) {
-	docDir := filepath.Dir(s.docPath)
+	s.mu.RLock()
+	assets := s.assets
+	s.mu.RUnlock()
 	rel := strings.TrimPrefix(r.URL.Path, "/assets/")
-	full := filepath.Join(docDir, filepath.FromSlash(rel))
-	absFull, err := filepath.Abs(full)
-	if err != nil || (!strings.HasPrefix(absFull, docDir+string(filepath.Separator)) && absFull != docDir) {
+	abs, ok := document.AssetFile(filepath.Dir(s.docPath), assets, rel)
+	if !ok {
 		http.NotFound(w, r)
 		return
 	}
-	http.ServeFile(w, r, absFull)
+	http.ServeFile(w, r, abs)
 }
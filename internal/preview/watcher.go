@@ -20,7 +20,7 @@ type Watcher struct {
 
 	mu        sync.Mutex
 	themePath string          // the single active theme file, updated via WatchTheme
-	includes  map[string]bool // included files currently watched, updated via WatchIncludes
+	deps      map[string]bool // dependency files currently watched, updated via WatchDependencies
 }
 
 // NewWatcher creates a watcher and adds each given path. A path that doesn't
@@ -74,14 +74,16 @@ func (w *Watcher) WatchTheme(path string) {
 	w.themePath = path
 }
 
-// WatchIncludes follows the document's `:::include` chapter files for content
-// edits, so editing a chapter reloads the preview. The include set can change
-// mid-session (the user adds or removes a `:::include`), so this is called on
-// every reload with the freshly-resolved set: paths no longer present are
-// dropped, newly-appeared ones are added. A file that can't be watched (e.g. it
-// was just deleted) is skipped — a broken include surfaces as a render error,
+// WatchDependencies follows the files the document's render depends on besides
+// the document itself — `:::include` chapters, `extends` bases, `data` files,
+// the project mdoc.yaml and its references file (see document.Dependencies) —
+// so editing any of them reloads the preview. The set can change mid-session
+// (the user adds or removes a `:::include`), so this is called on every reload
+// with the freshly-resolved set: paths no longer present are dropped,
+// newly-appeared ones are added. A file that can't be watched (e.g. it was
+// just deleted) is skipped — a broken dependency surfaces as a render error,
 // not a watcher failure.
-func (w *Watcher) WatchIncludes(paths []string) {
+func (w *Watcher) WatchDependencies(paths []string) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	next := make(map[string]bool, len(paths))
@@ -90,20 +92,20 @@ func (w *Watcher) WatchIncludes(paths []string) {
 			next[p] = true
 		}
 	}
-	for p := range w.includes {
+	for p := range w.deps {
 		if !next[p] {
 			_ = w.w.Remove(p)
 		}
 	}
 	for p := range next {
-		if !w.includes[p] {
+		if !w.deps[p] {
 			if err := w.w.Add(p); err != nil {
-				log.Printf("watch include %s: %v", p, err)
+				log.Printf("watch dependency %s: %v", p, err)
 				delete(next, p)
 			}
 		}
 	}
-	w.includes = next
+	w.deps = next
 }
 
 // Run blocks until Close is called. A 100ms debounce coalesces editor
@@ -11,7 +11,8 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// Local-only server; any origin is fine.
+	// Any origin is fine: a server reachable from the network is guarded by
+	// its access token instead (see authorize).
 	CheckOrigin: func(*http.Request) bool { return true },
 }
 
@@ -21,34 +22,19 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		log.Printf("ws upgrade: %v", err)
 		return
 	}
-
-	s.mu.Lock()
-	if s.conn != nil {
-		_ = s.conn.Close()
-		close(s.send)
-	}
-	s.conn = conn
-	s.send = make(chan []byte, 32)
-	send := s.send
-	s.mu.Unlock()
-
-	go s.writePump(conn, send)
-	s.readPump(conn)
+	c := newClient(conn)
+	s.hub.add(c)
+	go c.writePump()
+	s.readPump(c)
 }
 
-func (s *Server) readPump(conn *websocket.Conn) {
+func (s *Server) readPump(c *client) {
 	defer func() {
-		s.mu.Lock()
-		if s.conn == conn {
-			s.conn = nil
-			close(s.send)
-			s.send = nil
-		}
-		s.mu.Unlock()
-		_ = conn.Close()
+		s.hub.remove(c)
+		_ = c.conn.Close()
 	}()
 	for {
-		_, data, err := conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			return
 		}
@@ -65,11 +51,3 @@ func (s *Server) readPump(conn *websocket.Conn) {
 		}
 	}
 }
-
-func (s *Server) writePump(conn *websocket.Conn, send <-chan []byte) {
-	for data := range send {
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			return
-		}
-	}
-}
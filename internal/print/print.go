@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
 
 	"github.com/hinkolas/mdoc/internal/assets"
@@ -32,6 +33,17 @@ type Options struct {
 	WriteHTML bool
 	// Version is propagated into the render System.Version field.
 	Version string
+	// Row is the mail-merge record this print is for, exposed to templates
+	// as {{.Row}}; nil for an ordinary print.
+	Row map[string]any
+}
+
+// Result describes a written PDF.
+type Result struct {
+	// Path is the absolute path of the PDF.
+	Path string
+	// Pages is the number of pages paged.js laid the document out on.
+	Pages int
 }
 
 // ResolveOutputPath returns the absolute path Print will write to: the
@@ -48,62 +60,145 @@ func ResolveOutputPath(doc *document.Document, outputPath string) (string, error
 }
 
 // Print renders a document to PDF and writes it to disk. Returns the
-// absolute path of the resulting PDF.
-func Print(doc *document.Document, thm *theme.Theme, opts Options) (string, error) {
-	absOut, err := ResolveOutputPath(doc, opts.OutputPath)
+// absolute path and page count of the resulting PDF.
+func Print(doc *document.Document, thm *theme.Theme, opts Options) (*Result, error) {
+	p, err := NewPrinter(doc.Dir)
 	if err != nil {
-		return "", fmt.Errorf("resolve output path: %w", err)
+		return nil, err
 	}
+	defer p.Close()
+	return p.Print(doc, thm, opts)
+}
+
+// Printer prints any number of documents from one directory with a single
+// print server and a single headless Chromium, so a mail merge doesn't pay
+// the browser start-up once per record. Chromium is launched by the first
+// Print. Call Close when done.
+type Printer struct {
+	srv *printServer
+	br  *browser.Browser
+}
 
-	srv, err := startPrintServer(doc.Dir)
+// NewPrinter starts the print server for documents in docDir.
+func NewPrinter(docDir string) (*Printer, error) {
+	srv, err := startPrintServer(docDir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer srv.shutdown()
+	return &Printer{srv: srv}, nil
+}
 
-	html, err := render.Render(doc, thm, render.Options{
-		VendorBase: srv.url + "/_/vendor",
-		BaseHref:   srv.url + "/",
-		Version:    opts.Version,
-	})
+// Close shuts down Chromium (if it was started) and the print server.
+func (p *Printer) Close() {
+	if p.br != nil {
+		p.br.Close()
+	}
+	p.srv.shutdown()
+}
+
+// Print renders a document to PDF and writes it to disk, like the package
+// level Print, reusing the printer's server and browser.
+func (p *Printer) Print(doc *document.Document, thm *theme.Theme, opts Options) (*Result, error) {
+	absOut, err := ResolveOutputPath(doc, opts.OutputPath)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("resolve output path: %w", err)
 	}
-	srv.setHTML(html)
 
+	html, _, err := p.prepare(doc, thm, opts)
+	if err != nil {
+		return nil, err
+	}
 	if opts.WriteHTML {
 		debug := absOut[:len(absOut)-len(filepath.Ext(absOut))] + ".html"
 		if err := os.WriteFile(debug, []byte(html), 0o644); err != nil {
-			return "", fmt.Errorf("write debug html: %w", err)
+			return nil, fmt.Errorf("write debug html: %w", err)
 		}
 	}
 
-	pdf, err := renderPDF(srv.url + "/")
+	page := p.br.Page()
+	pages, err := paginate(page, p.srv.url+"/")
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	pdf, err := renderPDF(page)
+	if err != nil {
+		return nil, err
 	}
-	if err := os.WriteFile(absOut, pdf, 0o644); err != nil {
-		return "", fmt.Errorf("write pdf: %w", err)
+	if err := writeFileAtomic(absOut, pdf); err != nil {
+		return nil, fmt.Errorf("write pdf: %w", err)
 	}
-	return absOut, nil
+	return &Result{Path: absOut, Pages: pages}, nil
 }
 
-// renderPDF launches a headless browser, navigates to the prepared URL,
-// waits for paged.js to finish pagination, then captures the PDF.
-func renderPDF(url string) ([]byte, error) {
-	br, err := browser.Headless()
+// writeFileAtomic writes data to path through a temporary file next to it, so
+// a PDF viewer that reloads the file on change (the preview of `mdoc watch`)
+// never reads it half-written.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer os.Remove(f.Name()) // a no-op once renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
 	}
-	defer br.Close()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
 
-	page := br.Page()
+// Pages lays a document out exactly as Print would and returns its page count
+// without writing a PDF, plus the theme data of that render, whose Stats
+// `mdoc stats` reports alongside.
+func (p *Printer) Pages(doc *document.Document, thm *theme.Theme, opts Options) (int, render.ThemeData, error) {
+	_, td, err := p.prepare(doc, thm, opts)
+	if err != nil {
+		return 0, td, err
+	}
+	n, err := paginate(p.br.Page(), p.srv.url+"/")
+	return n, td, err
+}
 
+// prepare renders the document for the print server and makes sure Chromium
+// is running. It returns the rendered HTML and the theme data it was rendered
+// with.
+func (p *Printer) prepare(doc *document.Document, thm *theme.Theme, opts Options) (string, render.ThemeData, error) {
+	ropts := render.Options{
+		VendorBase: p.srv.url + "/_/vendor",
+		BaseHref:   p.srv.url + "/",
+		Version:    opts.Version,
+		Row:        opts.Row,
+	}
+	themed, td, err := render.RenderThemed(doc, thm, ropts)
+	if err != nil {
+		return "", td, err
+	}
+	html, err := render.Wrap(themed, td, ropts)
+	if err != nil {
+		return "", td, err
+	}
+	p.srv.setDocument(html, doc.Assets)
+	if p.br == nil {
+		if p.br, err = browser.Headless(); err != nil {
+			return "", td, err
+		}
+	}
+	return html, td, nil
+}
+
+// paginate navigates page to the prepared URL, waits for paged.js to finish
+// pagination, and returns the number of pages it laid out.
+func paginate(page *rod.Page, url string) (int, error) {
 	if err := page.Navigate(url); err != nil {
-		return nil, fmt.Errorf("navigate: %w", err)
+		return 0, fmt.Errorf("navigate: %w", err)
 	}
 	if err := page.WaitLoad(); err != nil {
-		return nil, fmt.Errorf("wait load: %w", err)
+		return 0, fmt.Errorf("wait load: %w", err)
 	}
 
 	// shell.html exposes window.__mdocPagedDone as a Promise that resolves
@@ -111,10 +206,18 @@ func renderPDF(url string) ([]byte, error) {
 	// guarantees the .pagedjs_page elements are in the DOM before PDF
 	// capture. 60s is a generous ceiling for very large documents.
 	timedPage := page.Timeout(60 * time.Second)
-	if _, err := timedPage.Eval(`async () => { await window.__mdocPagedDone; return true; }`); err != nil {
-		return nil, fmt.Errorf("wait for paged.js: %w", err)
+	res, err := timedPage.Eval(`async () => {
+		await window.__mdocPagedDone;
+		return document.querySelectorAll("#mdoc-pages .pagedjs_page").length;
+	}`)
+	if err != nil {
+		return 0, fmt.Errorf("wait for paged.js: %w", err)
 	}
+	return res.Value.Int(), nil
+}
 
+// renderPDF captures a paginated page (see paginate) as a PDF.
+func renderPDF(page *rod.Page) ([]byte, error) {
 	// Paged.js has already laid out each printable page into a .pagedjs_page
 	// element with its own @page-derived size and margins. Tell Chromium to
 	// honor those CSS page sizes and not add any of its own margins on top.
@@ -148,18 +251,20 @@ func renderPDF(url string) ([]byte, error) {
 //
 //   - "/"            : the rendered document HTML
 //   - "/_/vendor/*"  : embedded paged.js + KaTeX
-//   - "/<rest>"      : files inside the source document's directory, so
+//   - "/<rest>"      : files inside the source document's directory and the
+//                      files outside it that its rebased URLs name, so
 //                      relative <img> / <a href> URLs resolve.
 //
 // Using HTTP instead of file:// lets us sidestep Chromium's same-origin
 // restrictions on file:// resources, which silently break vendor loading
 // when the rendered HTML and the vendor tree live in different directories.
 type printServer struct {
-	url     string
-	docDir  string
-	html    string
-	httpSrv *http.Server
-	ln      net.Listener
+	url      string
+	docDir   string
+	html     string
+	assets   []string
+	httpSrv  *http.Server
+	ln       net.Listener
 }
 
 func startPrintServer(docDir string) (*printServer, error) {
@@ -180,7 +285,11 @@ func startPrintServer(docDir string) (*printServer, error) {
 	return ps, nil
 }
 
-func (ps *printServer) setHTML(html string) { ps.html = html }
+// setDocument sets the rendered HTML to serve and the files outside the
+// document's directory its rebased asset URLs name (see Document.Assets).
+func (ps *printServer) setDocument(html string, assets []string) {
+	ps.html, ps.assets = html, assets
+}
 
 func (ps *printServer) shutdown() {
 	if ps.httpSrv != nil {
@@ -191,19 +300,18 @@ func (ps *printServer) shutdown() {
 func (ps *printServer) handleAny(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/" || r.URL.Path == "/index.html" {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// A Printer serves a new render at the same URL for every record.
+		w.Header().Set("Cache-Control", "no-store")
 		_, _ = io.WriteString(w, ps.html)
 		return
 	}
 	// Anything else is a relative reference from the document body; serve
-	// it out of the document's directory with a path-traversal guard.
+	// it out of the document's directory, or one of the files outside it
+	// the document links, with a path-traversal guard (see
+	// document.AssetFile).
 	rel := strings.TrimPrefix(r.URL.Path, "/")
-	full := filepath.Join(ps.docDir, filepath.FromSlash(rel))
-	abs, err := filepath.Abs(full)
-	if err != nil {
-		http.NotFound(w, r)
-		return
-	}
-	if !strings.HasPrefix(abs, ps.docDir+string(filepath.Separator)) && abs != ps.docDir {
+	abs, ok := document.AssetFile(ps.docDir, ps.assets, rel)
+	if !ok {
 		http.NotFound(w, r)
 		return
 	}
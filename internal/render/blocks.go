@@ -0,0 +1,81 @@
+package render
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+)
+
+// Block markers split the rendered body into its top-level blocks for the
+// preview's incremental repaint (see Options.BlockMarkers): every block is led
+// by `<!--mdoc-block:ID-->`, and the last one is followed by
+// `<!--mdoc-blocks-end-->`. Comments don't take part in CSS selectors, so the
+// markers leave the theme's styling alone.
+const (
+	blockMarker    = "<!--mdoc-block:"
+	blockMarkerEnd = "-->"
+	blocksEnd      = "<!--mdoc-blocks-end-->"
+)
+
+// Block is one top-level block of a rendered body.
+type Block struct {
+	// ID is stable across renders: a hash of the block's HTML, plus a count
+	// for repeats, so an unchanged block keeps its ID wherever it moves.
+	ID   string `json:"id"`
+	HTML string `json:"html,omitempty"`
+}
+
+// renderBlocks renders the top-level children of doc one by one, each led by
+// its block marker.
+func renderBlocks(w io.Writer, r renderer.Renderer, source []byte, doc gast.Node) error {
+	var buf strings.Builder
+	seen := map[uint64]int{}
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		buf.Reset()
+		if err := r.Render(&buf, source, n); err != nil {
+			return err
+		}
+		h := fnv.New64a()
+		_, _ = io.WriteString(h, buf.String())
+		sum := h.Sum64()
+		id := strconv.FormatUint(sum, 36)
+		if seen[sum] > 0 {
+			id += "-" + strconv.Itoa(seen[sum])
+		}
+		seen[sum]++
+		if _, err := fmt.Fprintf(w, "%s%s%s%s", blockMarker, id, blockMarkerEnd, buf.String()); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, blocksEnd)
+	return err
+}
+
+// SplitBlocks splits themed HTML rendered with Options.BlockMarkers into the
+// theme's markup before and after the body, and the body's blocks. ok is false
+// when the markers aren't there exactly once, e.g. a theme that leaves the
+// body out or prints it twice.
+func SplitBlocks(themed string) (prefix string, blocks []Block, suffix string, ok bool) {
+	end := strings.Index(themed, blocksEnd)
+	if end < 0 || strings.Count(themed, blocksEnd) != 1 {
+		return "", nil, "", false
+	}
+	start := strings.Index(themed[:end], blockMarker)
+	if start < 0 {
+		return themed[:end], nil, themed[end+len(blocksEnd):], true // an empty body
+	}
+	prefix, suffix = themed[:start], themed[end+len(blocksEnd):]
+	for _, part := range strings.Split(themed[start+len(blockMarker):end], blockMarker) {
+		id, html, found := strings.Cut(part, blockMarkerEnd)
+		if !found {
+			return "", nil, "", false
+		}
+		blocks = append(blocks, Block{ID: id, HTML: html})
+	}
+	return prefix, blocks, suffix, true
+}
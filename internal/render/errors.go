@@ -0,0 +1,59 @@
+package render
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/theme"
+)
+
+// SourceError is a render error pinned to a line of a source file — the
+// document, an included chapter, or the theme — so the preview can show where
+// it happened.
+type SourceError struct {
+	File string // absolute path
+	Line int    // 1-based
+	Err  error
+}
+
+func (e *SourceError) Error() string { return e.Err.Error() }
+
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// templateLine matches the position Go's template errors lead with:
+// `template: body:12:5: executing …` or `template: body:12: unexpected …`.
+var templateLine = regexp.MustCompile(`template: ([^:]+):(\d+)`)
+
+// errLine returns the template name and line an error names, or "" and 0.
+func errLine(err error) (string, int) {
+	m := templateLine.FindStringSubmatch(err.Error())
+	if m == nil {
+		return "", 0
+	}
+	n, _ := strconv.Atoi(m[2])
+	return m[1], n
+}
+
+// bodyError pins a body template error to the document or chapter line it
+// names, through the document's line map.
+func bodyError(doc *document.Document, err error) error {
+	name, n := errLine(err)
+	if name != "body" || n < 1 || n > len(doc.Lines) {
+		return err
+	}
+	l := doc.Lines[n-1]
+	return &SourceError{File: l.File, Line: l.Line, Err: err}
+}
+
+// themeError pins a theme template error to its line in the theme file. A
+// built-in theme has no file, and errors in the default title page aren't in
+// it, so those stay unpinned.
+func themeError(thm *theme.Theme, err error) error {
+	name, n := errLine(err)
+	if n > 0 && thm.Path != "" && name == filepath.Base(thm.Path) {
+		return &SourceError{File: thm.Path, Line: n, Err: err}
+	}
+	return err
+}
@@ -8,17 +8,23 @@ import (
 	_ "embed"
 	"fmt"
 	htmltmpl "html/template"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	texttmpl "text/template"
 
 	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/funcs"
+	"github.com/hinkolas/mdoc/internal/locale"
 	"github.com/hinkolas/mdoc/internal/mdext"
 	"github.com/hinkolas/mdoc/internal/theme"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
 )
 
 //go:embed shell.html
@@ -30,6 +36,9 @@ type SystemData struct {
 	Date    string
 	Time    string
 	Version string
+	// Now is the render time, for formatting with the `date` template
+	// function: {{.System.Now | date "long"}}.
+	Now time.Time
 }
 
 // ThemeData is what theme templates and the markdown body template see.
@@ -37,10 +46,41 @@ type ThemeData struct {
 	Title  string
 	Author string
 	Tags   []string
+	// The title page fields (see document.Config), laid out by `:::titlepage`
+	// through the theme's "titlepage" template.
+	Subtitle    string
+	Date        string
+	Institution string
+	Supervisor  string
+	Logo        string
+	Version     string
+	Abstract    string
+	// Lang is the document's language tag (`lang`, "en" by default).
+	Lang string
+	// Labels are the generated strings of the document's language with the
+	// frontmatter `labels` applied, for headings a theme or the body writes
+	// itself: {{.Labels.contents}}. See internal/locale for the keys.
+	Labels map[string]string
 	Page   document.Page
-	Data   map[string]any
-	Body   htmltmpl.HTML
-	System SystemData
+	// Footnotes is the footnote placement, for themes to style by:
+	// {{if eq .Footnotes.Restart "page"}}…{{end}}.
+	Footnotes document.Footnotes
+	Data      map[string]any
+	Body      htmltmpl.HTML
+	// Stats are the body's word and character counts (see mdext.Stats). They
+	// come out of the markdown conversion, so only the theme sees them; in the
+	// body template they are zero.
+	Stats mdext.Stats
+	// Sidenotes reports whether the body has `[>note]` margin notes, so a theme
+	// can widen the outer margin for them. Like Stats, theme only.
+	Sidenotes bool
+	// Headings are the headings that go into the table of contents, in
+	// document order (see mdext.HeadingEntry). Like Stats, theme only.
+	Headings []mdext.HeadingEntry
+	System   SystemData
+	// Row is the record being rendered in a mail merge, one row of the
+	// `--each` data file: {{.Row.name}}. Nil otherwise.
+	Row map[string]any
 }
 
 // Options configure where browser-visible asset URLs point.
@@ -57,12 +97,23 @@ type Options struct {
 	HeadInject htmltmpl.HTML
 	// Version is reported as System.Version inside templates.
 	Version string
+	// Row is the current mail-merge record (`mdoc print --each`), reported as
+	// Row inside templates.
+	Row map[string]any
+	// SourceMap marks every block with a data-src="file:line" attribute
+	// pointing at its source, for the preview's click-to-source.
+	SourceMap bool
+	// BlockMarkers leads every top-level block of the body with a comment
+	// carrying a stable block ID, for the preview's incremental repaint (see
+	// SplitBlocks).
+	BlockMarkers bool
 }
 
 // shellData drives shell.html. URLs are wrapped in template.URL so
 // html/template doesn't refuse to emit file:// links.
 type shellData struct {
 	Title      string
+	Lang       string
 	BaseHref   htmltmpl.URL
 	VendorBase htmltmpl.URL
 	HeadInject htmltmpl.HTML
@@ -75,31 +126,71 @@ type shellData struct {
 // hosts its own copy of paged.js on the client side.
 func RenderThemed(doc *document.Document, thm *theme.Theme, opts Options) (string, ThemeData, error) {
 	td := themeData(doc, opts)
+	env := funcs.Env{Lang: td.Lang}
 
 	// 1. Template pass over the markdown body so the user can interpolate
-	//    metadata like `{{.Title}}` inside their markdown.
-	bodyTmpl, err := texttmpl.New("body").Parse(doc.Body)
+	//    metadata like `{{.Title}}` inside their markdown. `include` here
+	//    splices a partial's markdown source, resolved like `:::include`.
+	bodyEnv := env
+	bodyEnv.Include = func(target string) (htmltmpl.HTML, error) {
+		_, body, err := doc.ReadInclude(target, doc.Dir)
+		return htmltmpl.HTML(body), err
+	}
+	bodyEnv.Markdown = renderMarkdown
+	bodyFuncs := funcs.Map(bodyEnv)
+	bodyTmpl, err := texttmpl.New("body").Funcs(bodyFuncs).Parse(doc.Body)
 	if err != nil {
-		return "", td, fmt.Errorf("parse body template: %w", err)
+		return "", td, bodyError(doc, fmt.Errorf("parse body template: %w", err))
 	}
 	var mdBuf bytes.Buffer
 	if err := bodyTmpl.Execute(&mdBuf, td); err != nil {
-		return "", td, fmt.Errorf("execute body template: %w", err)
+		return "", td, bodyError(doc, fmt.Errorf("execute body template: %w", err))
+	}
+
+	// The theme runs on a clone of the parsed theme so this render's
+	// document-dependent functions can be bound without racing a concurrent
+	// render (the shared original is never executed, so it stays clonable).
+	// Its "titlepage" template is executed when the body has a `:::titlepage`.
+	themeTmpl, err := thm.Template.Clone()
+	if err != nil {
+		return "", td, fmt.Errorf("clone theme template: %w", err)
+	}
+	themeEnv := env
+	themeEnv.Include = func(target string) (htmltmpl.HTML, error) {
+		return themeInclude(target, doc, thm)
+	}
+	themeEnv.Markdown = renderMarkdown
+	themeTmpl.Funcs(funcs.Map(themeEnv))
+	var titleErr error
+	titlePage := func() (string, error) {
+		var b bytes.Buffer
+		if err := themeTmpl.ExecuteTemplate(&b, "titlepage", td); err != nil {
+			titleErr = themeError(thm, fmt.Errorf("execute titlepage template: %w", err))
+			return "", titleErr
+		}
+		return b.String(), nil
 	}
 
 	// 2. Markdown -> HTML. The mdext extension adds section numbering, the
 	//    :::toc / :::bibliography / :::figure / :::lof directives, [@key]
 	//    citations, and [#id] cross-references from the document's frontmatter.
 	//    It is built per render so it sees this document's references, numbering,
-	//    and caption labels.
+	//    and generated strings.
 	md := goldmark.New(
 		goldmark.WithExtensions(
 			extension.GFM,
 			extension.Footnote,
 			mdext.New(mdext.Config{
-				References: doc.Config.References,
-				Numbering:  doc.Config.Numbering,
-				Labels:     doc.Config.Labels,
+				References:   doc.Config.References,
+				Numbering:    doc.Config.Numbering,
+				Labels:       td.Labels,
+				Lang:         td.Lang,
+				Smart:        doc.Config.Typography.Smart,
+				StatsExclude: doc.Config.Stats.Excluded(),
+				Footnotes:    doc.Config.Footnotes,
+				Columns:      doc.Config.Page.Columns,
+				TitlePage:    titlePage,
+				SourceMap:    sourceMap(doc, opts),
 			}),
 		),
 		goldmark.WithParserOptions(
@@ -112,27 +203,46 @@ func RenderThemed(doc *document.Document, thm *theme.Theme, opts Options) (strin
 	// (e.g. "Äußere Form" -> "aeussere-form" instead of the lossy default).
 	ctx := parser.NewContext(parser.WithIDs(mdext.NewIDs()))
 	var bodyHTML bytes.Buffer
-	if err := md.Convert(mdBuf.Bytes(), &bodyHTML, parser.WithContext(ctx)); err != nil {
+	src := mdBuf.Bytes()
+	root := md.Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+	if opts.BlockMarkers {
+		err = renderBlocks(&bodyHTML, md.Renderer(), src, root)
+	} else {
+		err = md.Renderer().Render(&bodyHTML, src, root)
+	}
+	if titleErr != nil {
+		return "", td, titleErr
+	}
+	if err != nil {
 		return "", td, fmt.Errorf("convert markdown: %w", err)
 	}
 	td.Body = htmltmpl.HTML(bodyHTML.String())
+	td.Stats = mdext.StatsOf(ctx)
+	td.Sidenotes = mdext.HasSidenotes(ctx)
+	td.Headings = mdext.HeadingsOf(ctx)
 
 	// 3. Theme wrap.
 	var themed bytes.Buffer
-	if err := thm.Template.Execute(&themed, td); err != nil {
-		return "", td, fmt.Errorf("execute theme template: %w", err)
+	if err := themeTmpl.Execute(&themed, td); err != nil {
+		return "", td, themeError(thm, fmt.Errorf("execute theme template: %w", err))
 	}
 	return themed.String(), td, nil
 }
 
 // Render runs the full pipeline: RenderThemed + shell wrap. The result is a
 // complete HTML document Chromium can load directly and have paged.js
-// paginate. Used by the print pipeline.
+// paginate.
 func Render(doc *document.Document, thm *theme.Theme, opts Options) (string, error) {
 	themed, td, err := RenderThemed(doc, thm, opts)
 	if err != nil {
 		return "", err
 	}
+	return Wrap(themed, td, opts)
+}
+
+// Wrap puts the result of RenderThemed into the shell: the complete HTML
+// document Render returns. Used by the print pipeline, which also keeps td.
+func Wrap(themed string, td ThemeData, opts Options) (string, error) {
 	shell, err := htmltmpl.New("shell").Parse(shellTemplate)
 	if err != nil {
 		return "", fmt.Errorf("parse shell template: %w", err)
@@ -140,6 +250,7 @@ func Render(doc *document.Document, thm *theme.Theme, opts Options) (string, err
 	var out bytes.Buffer
 	err = shell.Execute(&out, shellData{
 		Title:      td.Title,
+		Lang:       td.Lang,
 		BaseHref:   htmltmpl.URL(opts.BaseHref),
 		VendorBase: htmltmpl.URL(opts.VendorBase),
 		HeadInject: opts.HeadInject,
@@ -151,22 +262,103 @@ func Render(doc *document.Document, thm *theme.Theme, opts Options) (string, err
 	return out.String(), nil
 }
 
+// sourceMap labels each line of the document body with its "file:line", the
+// file relative to the document's directory, when opts asks for it. The labels
+// follow the body before its template pass, so they drift after a template
+// action that adds or removes lines.
+func sourceMap(doc *document.Document, opts Options) []string {
+	if !opts.SourceMap {
+		return nil
+	}
+	labels := make([]string, len(doc.Lines))
+	for i, l := range doc.Lines {
+		rel, err := filepath.Rel(doc.Dir, l.File)
+		if err != nil {
+			rel = l.File
+		}
+		labels[i] = filepath.ToSlash(rel) + ":" + strconv.Itoa(l.Line)
+	}
+	return labels
+}
+
+// themeInclude implements `include` for theme templates. A path resolves from
+// the theme file's directory (the document's for a built-in theme) and a key
+// from the include search dirs, as with `:::include`. Either way its relative
+// URLs are rebased onto the document's directory, which the page is served
+// from, and the files they name outside it land in doc.Assets for the preview
+// and print servers. Markdown partials (every key, and paths ending in .md) are
+// rendered to HTML; any other file is inserted as raw HTML, so a theme can split
+// out an HTML header or footer.
+func themeInclude(target string, doc *document.Document, thm *theme.Theme) (htmltmpl.HTML, error) {
+	dir := doc.Dir
+	if thm.Path != "" {
+		dir = filepath.Dir(thm.Path)
+	}
+	path, body, err := doc.ReadInclude(target, dir)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".md") {
+		return htmltmpl.HTML(body), nil
+	}
+	return renderMarkdown(body)
+}
+
+// renderMarkdown implements the `markdown` template function: plain GFM, with
+// none of the document-wide apparatus (numbering, citations) that only makes
+// sense for the body. A lone paragraph is unwrapped so the result can sit
+// inline, e.g. {{markdown .Data.subtitle}} inside a <p> of the theme.
+func renderMarkdown(src string) (htmltmpl.HTML, error) {
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		return "", fmt.Errorf("markdown: %w", err)
+	}
+	out := strings.TrimSpace(buf.String())
+	if inner, ok := strings.CutPrefix(out, "<p>"); ok {
+		if inner, ok = strings.CutSuffix(inner, "</p>"); ok && !strings.Contains(inner, "<p>") {
+			out = inner
+		}
+	}
+	return htmltmpl.HTML(out), nil
+}
+
 func themeData(doc *document.Document, opts Options) ThemeData {
 	now := time.Now()
 	version := opts.Version
 	if version == "" {
 		version = "dev"
 	}
+	lang := doc.Config.Lang
+	if lang == "" {
+		lang = locale.DefaultLang
+	}
+	loc := locale.Get(lang).WithLabels(doc.Config.Labels)
 	return ThemeData{
-		Title:  doc.Config.Title,
-		Author: doc.Config.Author,
-		Tags:   doc.Config.Tags,
-		Page:   doc.Config.Page,
-		Data:   doc.Config.Data,
+		Title:       doc.Config.Title,
+		Author:      doc.Config.Author,
+		Tags:        doc.Config.Tags,
+		Subtitle:    doc.Config.Subtitle,
+		Date:        doc.Config.Date,
+		Institution: doc.Config.Institution,
+		Supervisor:  doc.Config.Supervisor,
+		Logo:        doc.Config.Logo,
+		Version:     doc.Config.Version,
+		Abstract:    doc.Config.Abstract,
+		Lang:        lang,
+		Labels:      loc.Labels,
+		Page:        doc.Config.Page,
+		Footnotes:   doc.Config.Footnotes,
+		Data:        doc.Config.Data,
+		Row:         opts.Row,
 		System: SystemData{
-			Date:    now.Format("02 January 2006"),
-			Time:    now.Format("15:04:05"),
+			Date:    loc.Format(now, loc.Date),
+			Time:    loc.Format(now, loc.Time),
 			Version: version,
+			Now:     now,
 		},
 	}
 }
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hinkolas/mdoc/internal/document"
+	"github.com/hinkolas/mdoc/internal/theme"
+)
+
+// A theme without footnote styles, such as "none", gets the footnotes as an
+// endnote list: a page footnote would show mid-sentence there.
+func TestFootnotesWithoutThemeStyles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "doc.md")
+	src := "---\nmdoc: true\ntheme: none\n---\nText[^a] more.\n\n[^a]: The note.\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := document.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thm, warn := theme.Resolve(doc.Config.Theme, doc.Dir, doc.Project)
+	if warn != nil {
+		t.Fatalf("theme: %v", warn)
+	}
+	got, _, err := RenderThemed(doc, thm, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `class="footnotes"`) || !strings.Contains(got, "The note.") {
+		t.Errorf("expected an endnote list:\n%s", got)
+	}
+	if strings.Contains(got, `class="mdoc-footnote"`) {
+		t.Errorf("expected no inline footnote:\n%s", got)
+	}
+}
+
+// A partial a theme file includes from its own directory links its images
+// relative to that directory; they must reach the page, which is served from
+// the document's directory.
+func TestThemeIncludeRebasesOntoDocument(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	themeDir, docDir := t.TempDir(), t.TempDir()
+	for name, content := range map[string]string{
+		filepath.Join(themeDir, "brand.html"): `{{include "header.md"}}{{.Body}}`,
+		filepath.Join(themeDir, "header.md"):  "![](logo.png)",
+		filepath.Join(docDir, "doc.md"):       "---\nmdoc: true\ntheme: " + filepath.Join(themeDir, "brand.html") + "\n---\nText.\n",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc, err := document.Open(filepath.Join(docDir, "doc.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	thm, warn := theme.Resolve(doc.Config.Theme, doc.Dir, doc.Project)
+	if warn != nil {
+		t.Fatalf("theme: %v", warn)
+	}
+	got, _, err := RenderThemed(doc, thm, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := "_/file/" + strings.TrimPrefix(filepath.ToSlash(themeDir), "/") + "/logo.png"
+	if !strings.Contains(got, `src="`+ext+`"`) {
+		t.Errorf("expected the logo rebased to %s:\n%s", ext, got)
+	}
+	if file, ok := document.AssetFile(doc.Dir, doc.Assets, ext); !ok || file != filepath.Join(themeDir, "logo.png") {
+		t.Errorf("AssetFile(%s) = %q, %v; want the theme's logo", ext, file, ok)
+	}
+}
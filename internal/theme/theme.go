@@ -1,11 +1,12 @@
 // Package theme resolves and loads HTML theme templates. A theme value is read
 // one of two ways:
 //
-//   - A bare key (e.g. `thesis`) names a theme in the user config directory,
-//     ~/.config/mdoc/themes/<key>.html, or one of the themes compiled into the
-//     binary ("system", "none"). Bare keys are NOT searched for next to the
-//     document — that lookup is reserved for explicit paths, so it is always
-//     unambiguous which theme a key refers to.
+//   - A bare key (e.g. `thesis`) names a theme in the enclosing project's
+//     themes/ directory (next to an mdoc.yaml; see internal/config), in the
+//     user config directory, ~/.config/mdoc/themes/<key>.html, or one of the
+//     themes compiled into the binary ("system", "none"). Bare keys are NOT
+//     searched for next to the document — that lookup is reserved for explicit
+//     paths, so it is always unambiguous which theme a key refers to.
 //   - A scoped key (e.g. `kilohertz::legal::contract`) is a bare key in a
 //     subdirectory of the themes dir: the "::" segments map to path segments, so
 //     this resolves ~/.config/mdoc/themes/kilohertz/legal/contract.html. It lets
@@ -32,6 +33,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/hinkolas/mdoc/internal/config"
+	"github.com/hinkolas/mdoc/internal/funcs"
 	"github.com/hinkolas/mdoc/internal/paths"
 )
 
@@ -65,6 +68,9 @@ func (f *Fallback) Short() string {
 //go:embed system.html
 var systemHTML string
 
+//go:embed titlepage.html
+var titlepageHTML string
+
 const (
 	// DefaultName is the theme used when a document doesn't name one: a
 	// styled, dependable allrounder built into the binary. "system" reads as
@@ -93,24 +99,37 @@ func builtin(name string) *Theme {
 }
 
 func mustParse(name, src string) *Theme {
-	return &Theme{Name: name, Template: template.Must(template.New(name).Parse(src))}
+	return &Theme{Name: name, Template: template.Must(newTemplate(name).Parse(src))}
+}
+
+// newTemplate returns an empty theme template that knows the template function
+// library (see internal/funcs) and holds the default "titlepage" definition,
+// which the theme's source may redefine. The document-dependent functions are
+// unbound here; internal/render binds them on a clone for each render. The
+// default is parsed under its own name so an error in it isn't reported
+// against the theme's file.
+func newTemplate(name string) *template.Template {
+	t := template.New(name).Funcs(funcs.Map(funcs.Env{}))
+	template.Must(t.New("titlepage.html").Parse(titlepageHTML))
+	return t
 }
 
 // Resolve finds a theme. It ALWAYS returns a usable, non-nil theme. The value
-// is either a bare key, looked up in the user themes dir (~/.config/mdoc/themes)
-// and then the built-ins, or a path, resolved relative to docDir (see
-// isPath/resolvePath). An empty value is treated as the default theme key. A
-// user theme file takes precedence over a built-in of the same key, so the
-// built-in keywords ("system", "none") double as overridable starting points —
-// including the default: dropping a ~/.config/mdoc/themes/system.html customizes
-// what unstyled-by-frontmatter documents get. Anything that can't be found, or a
+// is either a bare key, looked up in the themes dirs of project (the
+// document's mdoc.yaml, or nil) and the user (see SearchDirs) and then the
+// built-ins, or a path, resolved relative to docDir (see isPath/resolvePath).
+// An empty value is treated as the default theme key. A user theme file takes
+// precedence over a built-in of the same key, so the built-in keywords
+// ("system", "none") double as overridable starting points — including the
+// default: dropping a ~/.config/mdoc/themes/system.html customizes what
+// unstyled-by-frontmatter documents get. Anything that can't be found, or a
 // theme file that fails to parse, falls back to the built-in default.
 //
 // The returned error is a non-fatal diagnostic, not a failure: callers should
 // render with the returned theme and surface the error as a warning rather
 // than abort. It is nil when the requested theme loaded cleanly (or resolved
 // to a built-in, including when no theme was named at all).
-func Resolve(value, docDir string) (*Theme, error) {
+func Resolve(value, docDir string, project *config.Project) (*Theme, error) {
 	if value == "" {
 		value = DefaultName
 	}
@@ -125,33 +144,35 @@ func Resolve(value, docDir string) (*Theme, error) {
 				Detail:    fmt.Sprintf("theme %q is not a valid scoped key: %v; using the built-in %q theme", value, err, DefaultName),
 			}
 		}
-		return resolveKey(value, rel)
+		return resolveKey(value, rel, project)
 	case paths.KindPath:
 		return resolvePath(value, docDir)
 	default: // KindFlatKey
-		return resolveKey(value, value)
+		return resolveKey(value, value, project)
 	}
 }
 
-// resolveKey loads a key theme from the user themes dir, then the built-ins. name
-// is the original value (for diagnostics and the built-in lookup); rel is the
-// path under the themes dir, which for a scoped key like "a::b" is "a/b". A user
-// file overrides a same-keyed built-in.
-func resolveKey(name, rel string) (*Theme, error) {
-	if userThemes, err := paths.ThemesDir(); err == nil {
-		candidate := filepath.Join(userThemes, rel+".html")
-		if _, err := os.Stat(candidate); err == nil {
-			tmpl, perr := template.ParseFiles(candidate)
-			if perr != nil {
-				return Default(), &Fallback{
-					Requested: name,
-					Used:      DefaultName,
-					Reason:    "failed to parse",
-					Detail:    fmt.Sprintf("theme %q failed to parse (%s): %v; using the built-in %q theme", name, paths.Display(candidate), perr, DefaultName),
-				}
+// resolveKey loads a key theme from the theme search dirs (see SearchDirs), then
+// the built-ins. name is the original value (for diagnostics and the built-in
+// lookup); rel is the path under a themes dir, which for a scoped key like "a::b"
+// is "a/b". A file in a search dir overrides a same-keyed built-in.
+func resolveKey(name, rel string, project *config.Project) (*Theme, error) {
+	dirs := SearchDirs(project)
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, rel+".html")
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		tmpl, perr := newTemplate(filepath.Base(candidate)).ParseFiles(candidate)
+		if perr != nil {
+			return Default(), &Fallback{
+				Requested: name,
+				Used:      DefaultName,
+				Reason:    "failed to parse",
+				Detail:    fmt.Sprintf("theme %q failed to parse (%s): %v; using the built-in %q theme", name, paths.Display(candidate), perr, DefaultName),
 			}
-			return &Theme{Name: name, Path: candidate, Template: tmpl}, nil
 		}
+		return &Theme{Name: name, Path: candidate, Template: tmpl}, nil
 	}
 
 	if thm := builtin(name); thm != nil {
@@ -159,8 +180,12 @@ func resolveKey(name, rel string) (*Theme, error) {
 	}
 
 	loc := "the user themes dir"
-	if userThemes, err := paths.ThemesDir(); err == nil {
-		loc = paths.Display(userThemes)
+	if len(dirs) > 0 {
+		shown := make([]string, len(dirs))
+		for i, d := range dirs {
+			shown[i] = paths.Display(d)
+		}
+		loc = strings.Join(shown, " or ")
 	}
 	return Default(), &Fallback{
 		Requested: name,
@@ -194,7 +219,7 @@ func resolvePath(value, docDir string) (*Theme, error) {
 			Detail:    fmt.Sprintf("theme file %q not found (%s); using the built-in %q theme", value, paths.Display(path), DefaultName),
 		}
 	}
-	tmpl, err := template.ParseFiles(path)
+	tmpl, err := newTemplate(filepath.Base(path)).ParseFiles(path)
 	if err != nil {
 		return Default(), &Fallback{
 			Requested: value,
@@ -206,13 +231,19 @@ func resolvePath(value, docDir string) (*Theme, error) {
 	return &Theme{Name: value, Path: path, Template: tmpl}, nil
 }
 
-// SearchDirs returns the directories watched for bare-key theme files: the user
-// themes dir (~/.config/mdoc/themes; see internal/paths). The live-preview
-// watcher uses it so a global theme created or changed mid-session is noticed;
-// path-valued themes are watched separately via their resolved file path.
-func SearchDirs() []string {
+// SearchDirs returns the directories bare-key theme files are looked up in for
+// a document in project (nil outside one), in order: the project's themes/
+// dir (see internal/config), then the user themes dir (~/.config/mdoc/themes;
+// see internal/paths). The live-preview watcher uses it so a key theme created
+// or changed mid-session is noticed; path-valued themes are watched separately
+// via their resolved file path.
+func SearchDirs(project *config.Project) []string {
+	var dirs []string
+	if project != nil {
+		dirs = append(dirs, project.ThemesDir())
+	}
 	if userThemes, err := paths.ThemesDir(); err == nil {
-		return []string{userThemes}
+		dirs = append(dirs, userThemes)
 	}
-	return nil
+	return dirs
 }
@@ -3,7 +3,10 @@ package theme
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/hinkolas/mdoc/internal/config"
 )
 
 // minimalTheme is a parseable theme body distinguishable from the built-ins.
@@ -33,7 +36,7 @@ func writeTheme(t *testing.T, path string) {
 
 func TestResolveEmptyUsesDefault(t *testing.T) {
 	setup(t)
-	thm, err := Resolve("", t.TempDir())
+	thm, err := Resolve("", t.TempDir(), nil)
 	if err != nil {
 		t.Fatalf("unexpected diagnostic: %v", err)
 	}
@@ -45,7 +48,7 @@ func TestResolveEmptyUsesDefault(t *testing.T) {
 func TestResolveBuiltinKeys(t *testing.T) {
 	setup(t)
 	for _, name := range []string{DefaultName, NoneName} {
-		thm, err := Resolve(name, t.TempDir())
+		thm, err := Resolve(name, t.TempDir(), nil)
 		if err != nil {
 			t.Errorf("%s: unexpected diagnostic: %v", name, err)
 		}
@@ -59,7 +62,7 @@ func TestResolveKeyFromUserThemesDir(t *testing.T) {
 	cfgThemes := setup(t)
 	writeTheme(t, filepath.Join(cfgThemes, "report.html"))
 
-	thm, err := Resolve("report", t.TempDir())
+	thm, err := Resolve("report", t.TempDir(), nil)
 	if err != nil {
 		t.Fatalf("unexpected diagnostic: %v", err)
 	}
@@ -74,7 +77,7 @@ func TestResolveScopedKey(t *testing.T) {
 	nested := filepath.Join(cfgThemes, "kilohertz", "legal", "contract.html")
 	writeTheme(t, nested)
 
-	thm, err := Resolve("kilohertz::legal::contract", t.TempDir())
+	thm, err := Resolve("kilohertz::legal::contract", t.TempDir(), nil)
 	if err != nil {
 		t.Fatalf("unexpected diagnostic: %v", err)
 	}
@@ -87,7 +90,7 @@ func TestResolveScopedKey(t *testing.T) {
 // diagnostic rather than resolving somewhere unexpected.
 func TestResolveScopedKeyMalformed(t *testing.T) {
 	setup(t)
-	thm, err := Resolve("legal::", t.TempDir())
+	thm, err := Resolve("legal::", t.TempDir(), nil)
 	if err == nil {
 		t.Fatal("expected diagnostic, got nil")
 	}
@@ -103,7 +106,7 @@ func TestResolveKeyIgnoresDocLocalThemesDir(t *testing.T) {
 	docDir := t.TempDir()
 	writeTheme(t, filepath.Join(docDir, "themes", "report.html"))
 
-	thm, err := Resolve("report", docDir)
+	thm, err := Resolve("report", docDir, nil)
 	if err == nil {
 		t.Fatal("expected not-found diagnostic, got nil")
 	}
@@ -112,12 +115,42 @@ func TestResolveKeyIgnoresDocLocalThemesDir(t *testing.T) {
 	}
 }
 
+// Inside an mdoc.yaml project, a bare key resolves from the project's themes/
+// dir first — from any document below the project root — and wins over a
+// same-keyed user theme.
+func TestResolveKeyFromProjectThemesDir(t *testing.T) {
+	cfgThemes := setup(t)
+	writeTheme(t, filepath.Join(cfgThemes, "report.html"))
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "mdoc.yaml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(project, "themes", "report.html")
+	writeTheme(t, want)
+	docDir := filepath.Join(project, "specs", "api")
+	if err := os.MkdirAll(docDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := config.FindProject(docDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thm, err := Resolve("report", docDir, p)
+	if err != nil {
+		t.Fatalf("unexpected diagnostic: %v", err)
+	}
+	if thm.Path != want {
+		t.Errorf("Path = %q, want project theme %q", thm.Path, want)
+	}
+}
+
 func TestResolveRelativePathFromDocDir(t *testing.T) {
 	setup(t)
 	docDir := t.TempDir()
 	writeTheme(t, filepath.Join(docDir, "themes", "thesis.html"))
 
-	thm, err := Resolve("./themes/thesis.html", docDir)
+	thm, err := Resolve("./themes/thesis.html", docDir, nil)
 	if err != nil {
 		t.Fatalf("unexpected diagnostic: %v", err)
 	}
@@ -135,7 +168,7 @@ func TestResolveParentRelativePath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	thm, err := Resolve("../thesis.html", docDir)
+	thm, err := Resolve("../thesis.html", docDir, nil)
 	if err != nil {
 		t.Fatalf("unexpected diagnostic: %v", err)
 	}
@@ -149,7 +182,7 @@ func TestResolveAbsolutePath(t *testing.T) {
 	abs := filepath.Join(t.TempDir(), "dev.html")
 	writeTheme(t, abs)
 
-	thm, err := Resolve(abs, t.TempDir())
+	thm, err := Resolve(abs, t.TempDir(), nil)
 	if err != nil {
 		t.Fatalf("unexpected diagnostic: %v", err)
 	}
@@ -160,7 +193,7 @@ func TestResolveAbsolutePath(t *testing.T) {
 
 func TestResolveMissingPathFallsBack(t *testing.T) {
 	setup(t)
-	thm, err := Resolve("./themes/nope.html", t.TempDir())
+	thm, err := Resolve("./themes/nope.html", t.TempDir(), nil)
 	if err == nil {
 		t.Fatal("expected not-found diagnostic, got nil")
 	}
@@ -175,3 +208,26 @@ func TestResolveMissingPathFallsBack(t *testing.T) {
 		t.Errorf("Name = %q, want fallback %q", thm.Name, DefaultName)
 	}
 }
+
+func TestTitlePageOverride(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cover.html")
+	src := `{{define "titlepage"}}<h1>{{.}}</h1>{{end}}{{.}}`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	thm, err := Resolve("./cover.html", dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected diagnostic: %v", err)
+	}
+	var out strings.Builder
+	if err := thm.Template.ExecuteTemplate(&out, "titlepage", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "<h1>x</h1>" {
+		t.Errorf("titlepage = %q, want the theme's own", out.String())
+	}
+	if Default().Template.Lookup("titlepage") == nil {
+		t.Error("built-in theme has no default titlepage")
+	}
+}